@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/etcd"
+)
+
+// cleanupOptions holds the flags of the cleanup command.
+type cleanupOptions struct {
+	etcdContainerName      string
+	apiServerContainerName string
+	etcdVolumeName         string
+	certsVolumeName        string
+	networkName            string
+	keepVolumes            bool
+}
+
+func newCleanupCommand(g *globalOptions) *cobra.Command {
+	opts := cleanupOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Remove the etcd and kube-apiserver containers, their network and volumes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, sess, err := loadSession(g)
+			if err != nil {
+				return err
+			}
+			sessionDefault(cmd, "etcd-container-name", &opts.etcdContainerName, sess.EtcdContainer)
+			sessionDefault(cmd, "apiserver-container-name", &opts.apiServerContainerName, sess.APIServerContainer)
+			sessionDefault(cmd, "etcd-volume-name", &opts.etcdVolumeName, sess.EtcdVolume)
+			sessionDefault(cmd, "certs-volume-name", &opts.certsVolumeName, sess.CertsVolume)
+			sessionDefault(cmd, "network-name", &opts.networkName, sess.Network.Name)
+
+			// Keep going on failure so a single missing resource does not leave the rest behind
+			var errs []error
+			if err := etcd.CleanupKubeAPIServer(cmd.Context(), g.runtime, opts.apiServerContainerName); err != nil {
+				errs = append(errs, err)
+			}
+			if err := etcd.CleanupEtcd(cmd.Context(), g.runtime, opts.etcdContainerName); err != nil {
+				errs = append(errs, err)
+			}
+			if err := etcd.CleanupNetwork(cmd.Context(), g.runtime, opts.networkName); err != nil {
+				errs = append(errs, err)
+			}
+			if !opts.keepVolumes {
+				for _, volumeName := range []string{opts.etcdVolumeName, opts.certsVolumeName} {
+					if err := etcd.CleanupVolume(cmd.Context(), g.runtime, volumeName); err != nil {
+						errs = append(errs, err)
+					}
+				}
+			}
+
+			return errors.Join(errs...)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.etcdContainerName, "etcd-container-name", etcd.DefaultEtcdContainerName, "name of the etcd container")
+	cmd.Flags().StringVar(&opts.apiServerContainerName, "apiserver-container-name", etcd.DefaultKubeAPIServerContainerName, "name of the kube-apiserver container")
+	cmd.Flags().StringVar(&opts.etcdVolumeName, "etcd-volume-name", etcd.DefaultEtcdVolumeName, "volume holding the restored etcd data")
+	cmd.Flags().StringVar(&opts.certsVolumeName, "certs-volume-name", etcd.DefaultCertsVolumeName, "volume holding the kube-apiserver certificates")
+	cmd.Flags().StringVar(&opts.networkName, "network-name", etcd.DefaultNetworkName, "network connecting etcd and kube-apiserver")
+	cmd.Flags().BoolVar(&opts.keepVolumes, "keep-volumes", false, "keep the etcd data and certificate volumes")
+
+	return cmd
+}
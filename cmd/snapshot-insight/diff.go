@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/decode"
+	"github.com/supporttools/snapshot-insight/pkg/diff"
+	"github.com/supporttools/snapshot-insight/pkg/encryption"
+)
+
+// registryPrefix holds every object kube-apiserver stores in etcd.
+const registryPrefix = "/registry/"
+
+// diffOptions holds the flags of the diff command.
+type diffOptions struct {
+	resources            []string
+	namespace            string
+	output               string
+	encryption           string
+	includeManagedFields bool
+}
+
+func newDiffCommand(g *globalOptions) *cobra.Command {
+	opts := diffOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "diff <before> <after>",
+		Short: "Compare the Kubernetes objects of two snapshots offline",
+		Long: `Decodes both snapshots offline and lists the objects added, removed and modified from the
+first to the second, with the old (-) and new (+) value of every differing field as YAML.
+Objects are matched by their etcd key.`,
+		Example: `  snapshot-insight diff before.db after.db
+  snapshot-insight diff before.db after.db -r deployments -r configmaps -n kube-system
+  snapshot-insight diff s3://backups/before.db s3://backups/after.db -o json`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.output != "text" && opts.output != "json" {
+				return fmt.Errorf("unsupported output format %q (expected text or json)", opts.output)
+			}
+
+			decryptor, err := loadDecryptor(opts.encryption)
+			if err != nil {
+				return err
+			}
+
+			before, skippedBefore, err := loadObjects(cmd.Context(), g, args[0], opts, decryptor)
+			if err != nil {
+				return err
+			}
+			after, skippedAfter, err := loadObjects(cmd.Context(), g, args[1], opts, decryptor)
+			if err != nil {
+				return err
+			}
+			// An object that cannot be decoded on one side would show up as added or removed
+			before, after = withoutKeys(before, skippedAfter), withoutKeys(after, skippedBefore)
+
+			ignored := diff.DefaultIgnoredFields
+			if opts.includeManagedFields {
+				ignored = nil
+			}
+			changes := diff.Compare(before, after, ignored)
+
+			if opts.output == "json" {
+				if changes == nil {
+					changes = []diff.Change{}
+				}
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(changes)
+			}
+			return diff.WriteText(os.Stdout, changes)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&opts.resources, "resource", "r", nil, "only compare these resources, e.g. deployments or certificates.cert-manager.io, may be repeated")
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "only compare objects in this namespace (defaults to all objects)")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "text", "output format: text or json")
+	cmd.Flags().StringVar(&opts.encryption, "encryption-config", "", "EncryptionConfiguration used to decrypt aescbc, aesgcm and secretbox encrypted values of both snapshots")
+	cmd.Flags().BoolVar(&opts.includeManagedFields, "include-managed-fields", false, "also compare metadata.managedFields")
+
+	return cmd
+}
+
+// loadObjects decodes the objects of a snapshot selected by the resource and namespace
+// filters. The keys that cannot be decoded are returned separately and counted on stderr.
+func loadObjects(ctx context.Context, g *globalOptions, snapshotPath string, opts diffOptions, decryptor *encryption.Decryptor) ([]diff.Object, map[string]bool, error) {
+	snap, closeSnapshot, err := openSnapshot(ctx, g, snapshotPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeSnapshot()
+
+	prefixes := []string{registryPrefix}
+	if len(opts.resources) > 0 {
+		prefixes = nil
+		for _, name := range opts.resources {
+			prefixes = append(prefixes, decode.LookupResource(name).KeyPrefix(opts.namespace))
+		}
+	}
+
+	// One pass over the snapshot, a key matching several prefixes is returned once
+	kvs, err := snap.KeysWithPrefixes(prefixes...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var objs []diff.Object
+	skipped := map[string]bool{}
+	encrypted := 0
+	for _, kv := range kvs {
+		obj, err := decodeKeyValue(decryptor, kv)
+		if err != nil {
+			if errors.Is(err, decode.ErrEncrypted) {
+				encrypted++
+			}
+			skipped[kv.Key] = true
+			continue
+		}
+		object, err := diff.NewObject(kv.Key, obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Resource prefixes already select the namespace of namespaced resources
+		if len(opts.resources) == 0 && opts.namespace != "" && object.Identity.Namespace != opts.namespace {
+			continue
+		}
+		objs = append(objs, object)
+	}
+
+	if len(skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d keys of %s that could not be decoded", len(skipped), snapshotPath)
+		if encrypted > 0 {
+			fmt.Fprintf(os.Stderr, ", %d of them encrypted (pass --encryption-config to decrypt them)", encrypted)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	return objs, skipped, nil
+}
+
+// withoutKeys returns the objects whose keys are not in keys.
+func withoutKeys(objs []diff.Object, keys map[string]bool) []diff.Object {
+	var kept []diff.Object
+	for _, obj := range objs {
+		if !keys[obj.Key] {
+			kept = append(kept, obj)
+		}
+	}
+	return kept
+}
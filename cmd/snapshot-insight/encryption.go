@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/encryption"
+)
+
+// encryptionConfigOptions holds the flags of the encryption-config commands.
+type encryptionConfigOptions struct {
+	output string
+}
+
+func newEncryptionConfigCommand() *cobra.Command {
+	opts := encryptionConfigOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "encryption-config",
+		Short: "Generate or import the EncryptionConfiguration used by kube-apiserver",
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "generate",
+			Short: "Write an identity-only EncryptionConfiguration",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := encryption.Identity().Write(opts.output); err != nil {
+					return err
+				}
+				fmt.Printf("Encryption configuration written to %s\n", opts.output)
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "import <node-backup>",
+			Short: "Copy the EncryptionConfiguration out of an RKE2, k3s or kubeadm node backup",
+			Long: `Copy the EncryptionConfiguration out of a control plane node backup.
+
+The backup may be the node's filesystem root or a copy of /var/lib/rancher/rke2,
+/var/lib/rancher/k3s or /etc/kubernetes. RKE2 and k3s keep the configuration in
+server/cred/encryption-config.json; for kubeadm the file named by
+--encryption-provider-config in the kube-apiserver static pod manifest is used.`,
+			Args: cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return importEncryptionConfig(args[0], opts.output)
+			},
+		},
+	)
+
+	cmd.PersistentFlags().StringVarP(&opts.output, "output", "o", "encryption-config.json", "path of the written configuration")
+
+	return cmd
+}
+
+// importEncryptionConfig copies the encryption configuration of a node backup to dst
+// and summarises the providers it found.
+func importEncryptionConfig(backup, dst string) error {
+	config, err := encryption.Import(backup, dst)
+	if err != nil {
+		return fmt.Errorf("failed to import encryption configuration: %v", err)
+	}
+
+	fmt.Printf("Imported encryption configuration from %s to %s\n", backup, dst)
+	for _, resource := range config.Resources {
+		var providers []string
+		for _, provider := range resource.Providers {
+			providers = append(providers, provider.Name())
+		}
+		fmt.Printf("  %v: %v\n", resource.Resources, providers)
+	}
+	return nil
+}
+
+// loadDecryptor prepares offline decryption with an EncryptionConfiguration, or
+// returns nil when no configuration is given.
+func loadDecryptor(path string) (*encryption.Decryptor, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	config, err := encryption.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewDecryptor(config)
+}
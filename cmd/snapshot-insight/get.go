@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/decode"
+	"github.com/supporttools/snapshot-insight/pkg/encryption"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// getOptions holds the flags of the get command.
+type getOptions struct {
+	namespace     string
+	allNamespaces bool
+	output        string
+	encryption    string
+	revision      int64
+}
+
+func newGetCommand(g *globalOptions) *cobra.Command {
+	opts := getOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "get <path-to-snapshot|s3://bucket/key> <resource> [name]",
+		Short: "Print Kubernetes objects straight from a snapshot file",
+		Example: `  snapshot-insight get snapshot.db pods -n kube-system
+  snapshot-insight get snapshot.db deploy coredns -n kube-system -o yaml
+  snapshot-insight get snapshot.db secret db-password -o yaml --encryption-config encryption-config.json
+  snapshot-insight get snapshot.db cm app-config -o yaml --revision 1842`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snapshotPath, args := args[0], args[1:]
+			resource := decode.LookupResource(args[0])
+			namespace := opts.namespace
+			if opts.allNamespaces {
+				namespace = ""
+			}
+
+			decryptor, err := loadDecryptor(opts.encryption)
+			if err != nil {
+				return err
+			}
+
+			snap, closeSnapshot, err := openSnapshot(cmd.Context(), g, snapshotPath)
+			if err != nil {
+				return err
+			}
+			defer closeSnapshot()
+
+			prefix := resource.KeyPrefix(namespace)
+			if len(args) == 2 {
+				prefix = resource.Key(namespace, args[1])
+			}
+			var kvs []snapshot.KeyValue
+			if opts.revision != 0 {
+				kvs, err = snap.KeysAt(prefix, opts.revision)
+			} else {
+				kvs, err = snap.Keys(prefix)
+			}
+			if err != nil {
+				return err
+			}
+
+			var objs []runtime.Object
+			for _, kv := range kvs {
+				// A name lookup must not match other objects sharing the name as a prefix
+				if len(args) == 2 && kv.Key != prefix {
+					continue
+				}
+				obj, err := decodeKeyValue(decryptor, kv)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "skipping %s: %v\n", kv.Key, err)
+					continue
+				}
+				objs = append(objs, obj)
+			}
+
+			if len(args) == 2 && len(objs) == 0 {
+				if opts.revision != 0 {
+					return fmt.Errorf("%s %q not found in snapshot at revision %d", resource.Name, args[1], opts.revision)
+				}
+				return fmt.Errorf("%s %q not found in snapshot", resource.Name, args[1])
+			}
+			return printObjects(objs, opts.output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "namespace of the objects")
+	cmd.Flags().BoolVarP(&opts.allNamespaces, "all-namespaces", "A", false, "list objects across all namespaces")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "table", "output format: table, yaml or json")
+	cmd.Flags().StringVar(&opts.encryption, "encryption-config", "", "EncryptionConfiguration used to decrypt aescbc, aesgcm and secretbox encrypted values")
+	cmd.Flags().Int64Var(&opts.revision, "revision", 0, "show the objects as they were at this etcd revision instead of the latest one")
+
+	return cmd
+}
+
+// decodeKeyValue decrypts the value of a key when a decryptor is given and decodes it.
+func decodeKeyValue(decryptor *encryption.Decryptor, kv snapshot.KeyValue) (runtime.Object, error) {
+	value := kv.Value
+	if decryptor != nil {
+		var err error
+		if value, err = decryptor.Decrypt(kv.Key, value); err != nil {
+			return nil, err
+		}
+	}
+	obj, err := decode.Decode(value)
+	if errors.Is(err, decode.ErrEncrypted) {
+		return nil, fmt.Errorf("%w (pass --encryption-config to decrypt it)", err)
+	}
+	return obj, err
+}
+
+// printObjects writes decoded objects in the requested output format.
+func printObjects(objs []runtime.Object, output string) error {
+	switch output {
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tKIND\tAPIVERSION")
+		for _, obj := range objs {
+			id := decode.Identify(obj)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", id.Namespace, id.Name, id.Kind, id.APIVersion)
+		}
+		return w.Flush()
+	case "yaml", "json":
+		obj := decode.NewList(objs)
+		if len(objs) == 1 {
+			obj = objs[0]
+		}
+
+		render := decode.ToYAML
+		if output == "json" {
+			render = decode.ToJSON
+		}
+		data, err := render(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.TrimSuffix(string(data), "\n"))
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q (expected table, yaml or json)", output)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/decode"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot"
+	"sigs.k8s.io/yaml"
+)
+
+// historyOptions holds the flags of the history command.
+type historyOptions struct {
+	namespace  string
+	output     string
+	encryption string
+}
+
+// historyEntry is a revision of a key, with the decoded object unless it was deleted.
+type historyEntry struct {
+	Revision int64           `json:"revision"`
+	Event    string          `json:"event"`
+	Version  int64           `json:"version,omitempty"`
+	Size     int             `json:"size"`
+	Object   json.RawMessage `json:"object,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// historyEvent names the change a revision records, like the events of a watch.
+func historyEvent(kv snapshot.KeyValue) string {
+	switch {
+	case kv.Tombstone:
+		return "DELETED"
+	case kv.Version == 1:
+		return "ADDED"
+	default:
+		return "MODIFIED"
+	}
+}
+
+func newHistoryCommand(g *globalOptions) *cobra.Command {
+	opts := historyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "history <path-to-snapshot|s3://bucket/key> <key> | history <path-to-snapshot|s3://bucket/key> <resource> <name>",
+		Short: "List the revisions of an object still kept in a snapshot",
+		Long: `Lists every revision of a key that etcd kept in the snapshot, up to the last compaction.
+Pass the full etcd key, or a resource and name like get. Use get --revision to see every
+object as it was at one of the listed revisions.`,
+		Example: `  snapshot-insight history snapshot.db deploy coredns -n kube-system
+  snapshot-insight history snapshot.db /registry/configmaps/default/app-config -o yaml`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snapshotPath, args := args[0], args[1:]
+			key := args[0]
+			if len(args) == 2 {
+				key = decode.LookupResource(args[0]).Key(opts.namespace, args[1])
+			} else if !strings.HasPrefix(key, "/") {
+				return fmt.Errorf("%q is not an etcd key, pass a key like /registry/pods/default/name or a resource and name", key)
+			}
+
+			decryptor, err := loadDecryptor(opts.encryption)
+			if err != nil {
+				return err
+			}
+
+			snap, closeSnapshot, err := openSnapshot(cmd.Context(), g, snapshotPath)
+			if err != nil {
+				return err
+			}
+			defer closeSnapshot()
+
+			history, err := snap.History(key)
+			if err != nil {
+				return err
+			}
+			if len(history) == 0 {
+				return fmt.Errorf("key %s not found in snapshot", key)
+			}
+
+			entries := make([]historyEntry, 0, len(history))
+			for _, kv := range history {
+				entry := historyEntry{Revision: kv.ModRevision, Event: historyEvent(kv), Version: kv.Version, Size: kv.Size}
+				if !kv.Tombstone && opts.output != "table" {
+					obj, err := decodeKeyValue(decryptor, kv)
+					if err == nil {
+						entry.Object, err = decode.ToJSON(obj)
+					}
+					if err != nil {
+						entry.Error = err.Error()
+					}
+				}
+				entries = append(entries, entry)
+			}
+
+			switch opts.output {
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(entries)
+			case "yaml":
+				return printHistoryYAML(entries)
+			case "table":
+				revision, err := snap.Revision()
+				if err != nil {
+					return err
+				}
+				compacted, err := snap.CompactRevision()
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "REVISION\tEVENT\tVERSION\tSIZE")
+				for _, entry := range entries {
+					fmt.Fprintf(w, "%d\t%s\t%d\t%d\n", entry.Revision, entry.Event, entry.Version, entry.Size)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				fmt.Printf("\n%d revisions of %s, snapshot revision %d", len(entries), key, revision)
+				if compacted > 0 {
+					fmt.Printf(", older revisions were compacted at revision %d", compacted)
+				}
+				fmt.Println()
+				return nil
+			default:
+				return fmt.Errorf("unsupported output format %q (expected table, yaml or json)", opts.output)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "namespace of the object")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "table", "output format: table, yaml or json")
+	cmd.Flags().StringVar(&opts.encryption, "encryption-config", "", "EncryptionConfiguration used to decrypt aescbc, aesgcm and secretbox encrypted values")
+
+	return cmd
+}
+
+// printHistoryYAML prints every revision as a YAML document headed by its revision and event.
+func printHistoryYAML(entries []historyEntry) error {
+	for i, entry := range entries {
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Printf("# revision %d: %s\n", entry.Revision, entry.Event)
+		switch {
+		case entry.Error != "":
+			fmt.Printf("# %s\n", entry.Error)
+		case entry.Object != nil:
+			data, err := yaml.JSONToYAML(entry.Object)
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(data))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/etcd"
+)
+
+// imagesOptions holds the flags of the images commands.
+type imagesOptions struct {
+	snapshotPath string
+	kubeVersion  string
+}
+
+// addFlags registers the flags on cmd, shared by all of its subcommands.
+func (o *imagesOptions) addFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&o.snapshotPath, "snapshot", "", "snapshot that start will serve, used to pick the same kube-apiserver version")
+	cmd.PersistentFlags().StringVar(&o.kubeVersion, "kube-version", "", "kube-apiserver version start will run, e.g. v1.28.5, overriding detection")
+}
+
+// images returns the images with the kube-apiserver version start would pick. The
+// detected version is reported on stderr so that the output of list stays usable.
+func (o *imagesOptions) images(ctx context.Context, g *globalOptions) (etcd.Images, error) {
+	images := g.images
+	apiServerImage, err := resolveKubeAPIServerImage(ctx, g, os.Stderr, o.kubeVersion, o.snapshotPath)
+	if err != nil {
+		return etcd.Images{}, err
+	}
+	images.KubeAPIServer = apiServerImage
+	return images, nil
+}
+
+func newImagesCommand(g *globalOptions) *cobra.Command {
+	opts := imagesOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "List, pull and load the container images used by snapshot-insight",
+		Long: `List, pull and load the container images used by snapshot-insight.
+
+For disconnected hosts, pull the images on a connected machine and save them:
+  docker save -o images.tar $(snapshot-insight images list)
+then load the tarball on the disconnected host and run with --pull-policy never.
+Pass the snapshot or --kube-version to include the kube-apiserver version start will run.`,
+	}
+	opts.addFlags(cmd)
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "Print the images that restore and start will use",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				images, err := opts.images(cmd.Context(), g)
+				if err != nil {
+					return err
+				}
+				for _, image := range images.List() {
+					fmt.Println(image)
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "pull",
+			Short: "Pull the images according to the pull policy",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				images, err := opts.images(cmd.Context(), g)
+				if err != nil {
+					return err
+				}
+				for _, image := range images.List() {
+					if err := etcd.EnsureImage(cmd.Context(), g.runtime, image, images.PullPolicy); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "load <tarball>...",
+			Short: "Load images from tarballs created with docker save",
+			Args:  cobra.MinimumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				images, err := opts.images(cmd.Context(), g)
+				if err != nil {
+					return err
+				}
+				for _, tarball := range args {
+					path, err := filepath.Abs(tarball)
+					if err != nil {
+						return fmt.Errorf("failed to resolve image tarball path %s: %v", tarball, err)
+					}
+					fmt.Printf("Loading images from %s...\n", path)
+					if err := g.runtime.Load(cmd.Context(), path); err != nil {
+						return fmt.Errorf("failed to load images from %s: %v", path, err)
+					}
+				}
+
+				for _, image := range images.List() {
+					if !g.runtime.ImageExists(cmd.Context(), image) {
+						fmt.Printf("Warning: image %s is still missing\n", image)
+					}
+				}
+				return nil
+			},
+		},
+	)
+
+	return cmd
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/encryption"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot"
+)
+
+// inspectOptions holds the flags of the inspect command.
+type inspectOptions struct {
+	prefix     string
+	limit      int
+	output     string
+	encryption string
+	revision   int64
+}
+
+// inspectEntry is a listed key with how its value is encrypted at rest.
+type inspectEntry struct {
+	snapshot.KeyValue
+	// Encryption is the provider and key name of an encrypted value.
+	Encryption string `json:"encryption,omitempty"`
+	// Decrypted reports whether the value could be decrypted with --encryption-config.
+	Decrypted *bool `json:"decrypted,omitempty"`
+}
+
+func newInspectCommand(g *globalOptions) *cobra.Command {
+	opts := inspectOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "inspect <path-to-snapshot|s3://bucket/key>",
+		Short: "List the keys of a snapshot offline, without starting any container",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			decryptor, err := loadDecryptor(opts.encryption)
+			if err != nil {
+				return err
+			}
+
+			snap, closeSnapshot, err := openSnapshot(cmd.Context(), g, args[0])
+			if err != nil {
+				return err
+			}
+			defer closeSnapshot()
+
+			var kvs []snapshot.KeyValue
+			if opts.revision != 0 {
+				kvs, err = snap.KeysAt(opts.prefix, opts.revision)
+			} else {
+				kvs, err = snap.Keys(opts.prefix)
+			}
+			if err != nil {
+				return err
+			}
+			total := len(kvs)
+			if opts.limit > 0 && len(kvs) > opts.limit {
+				kvs = kvs[:opts.limit]
+			}
+
+			entries := make([]inspectEntry, 0, len(kvs))
+			failed := 0
+			for _, kv := range kvs {
+				entry := inspectEntry{KeyValue: kv}
+				if envelope, encrypted := encryption.Describe(kv.Value); encrypted {
+					entry.Encryption = envelope.String()
+					if decryptor != nil {
+						_, err := decryptor.Decrypt(kv.Key, kv.Value)
+						decrypted := err == nil
+						entry.Decrypted = &decrypted
+						if !decrypted {
+							failed++
+						}
+					}
+				}
+				entries = append(entries, entry)
+			}
+
+			switch opts.output {
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(entries)
+			case "table":
+				revision := opts.revision
+				if revision == 0 {
+					if revision, err = snap.Revision(); err != nil {
+						return err
+					}
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "KEY\tCREATE_REV\tMOD_REV\tVERSION\tSIZE\tENCRYPTION")
+				for _, entry := range entries {
+					scheme := entry.Encryption
+					switch {
+					case scheme == "":
+						scheme = "-"
+					case entry.Decrypted != nil && *entry.Decrypted:
+						scheme += " (decrypted)"
+					case entry.Decrypted != nil:
+						scheme += " (undecryptable)"
+					}
+					fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", entry.Key, entry.CreateRevision, entry.ModRevision, entry.Version, entry.Size, scheme)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				fmt.Printf("\n%d keys shown of %d, at revision %d\n", len(kvs), total, revision)
+				if failed > 0 {
+					fmt.Printf("%d encrypted values could not be decrypted with %s\n", failed, opts.encryption)
+				}
+				return nil
+			default:
+				return fmt.Errorf("unsupported output format %q (expected table or json)", opts.output)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.prefix, "prefix", "", "only list keys with this prefix, e.g. /registry/pods/")
+	cmd.Flags().IntVar(&opts.limit, "limit", 0, "maximum number of keys to list (0 for all)")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "table", "output format: table or json")
+	cmd.Flags().StringVar(&opts.encryption, "encryption-config", "", "EncryptionConfiguration used to check that encrypted values can be decrypted")
+	cmd.Flags().Int64Var(&opts.revision, "revision", 0, "list the keys as they were at this etcd revision instead of the latest one")
+
+	return cmd
+}
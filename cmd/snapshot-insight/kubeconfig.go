@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/etcd"
+	"github.com/supporttools/snapshot-insight/pkg/kubeconfig"
+	"github.com/supporttools/snapshot-insight/pkg/session"
+)
+
+// kubeconfigFlags are the kubeconfig flags shared by start and kubeconfig.
+type kubeconfigFlags struct {
+	context   string
+	namespace string
+	user      string
+}
+
+// addFlags registers the flags on cmd.
+func (f *kubeconfigFlags) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.context, "context", "", "name of the kubeconfig cluster, user and context (defaults to snapshot-insight-<session>-<snapshot>)")
+	cmd.Flags().StringVar(&f.namespace, "namespace", "", "default namespace of the kubeconfig context")
+	cmd.Flags().StringVar(&f.user, "kubeconfig-user", string(etcd.UserCertificate), fmt.Sprintf("credentials of the kubeconfig user, one of %v", etcd.UserTypes))
+}
+
+// options resolves the flags for a session.
+func (f *kubeconfigFlags) options(sess *session.Session) (etcd.KubeconfigOptions, error) {
+	userType, err := etcd.ParseUserType(f.user)
+	if err != nil {
+		return etcd.KubeconfigOptions{}, err
+	}
+	opts := etcd.KubeconfigOptions{Context: f.context, Namespace: f.namespace, User: userType, ReadOnly: sess.ReadOnly}
+	if opts.Context == "" {
+		opts.Context = kubeconfigContext(sess)
+	}
+	if userType == etcd.UserExec {
+		executable, err := os.Executable()
+		if err != nil {
+			return etcd.KubeconfigOptions{}, fmt.Errorf("failed to locate snapshot-insight for the exec credential plugin: %v", err)
+		}
+		opts.ExecCommand = []string{executable, "--session", sess.Name, "credential"}
+	}
+	return opts, nil
+}
+
+// contextNameInvalid matches what is replaced in generated context names.
+var contextNameInvalid = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// kubeconfigContext returns the default context name of a session. It includes the
+// snapshot restored into the session so that the contexts of several snapshots can be
+// merged into one kubeconfig.
+func kubeconfigContext(sess *session.Session) string {
+	name := etcd.DefaultKubeconfigContext + "-" + sess.Name
+	if sess.Snapshot == "" {
+		return name
+	}
+	snapshot := strings.ToLower(filepath.Base(sess.Snapshot))
+	snapshot = strings.TrimSuffix(snapshot, filepath.Ext(snapshot))
+	snapshot = strings.Trim(contextNameInvalid.ReplaceAllString(snapshot, "-"), "-.")
+	if snapshot == "" {
+		return name
+	}
+	return name + "-" + snapshot
+}
+
+// kubeAPIServerURL returns the URL kubectl reaches the kube-apiserver of a session at.
+func kubeAPIServerURL(sess *session.Session) (string, error) {
+	// Only host networking listens on the host IP, bridge mode publishes on the loopback address
+	hostIP := ""
+	if sess.Network.IsHost() {
+		var err error
+		if hostIP, err = etcd.HostIPAddress(); err != nil {
+			return "", fmt.Errorf("failed to resolve host IP address: %v", err)
+		}
+	}
+	return sess.Network.KubeAPIServerURL(hostIP, sess.Ports), nil
+}
+
+// kubeconfigOptions holds the flags of the kubeconfig command.
+type kubeconfigOptions struct {
+	kubeconfigFlags
+	output string
+	server string
+	merge  bool
+}
+
+func newKubeconfigCommand(g *globalOptions) *cobra.Command {
+	opts := kubeconfigOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Write a kubeconfig for the running kube-apiserver",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, sess, err := loadSession(g)
+			if err != nil {
+				return err
+			}
+			kubeconfigOpts, err := opts.options(sess)
+			if err != nil {
+				return err
+			}
+			kubeconfigOpts.Merge = opts.merge
+
+			serverURL := opts.server
+			if serverURL == "" {
+				if serverURL, err = kubeAPIServerURL(sess); err != nil {
+					return err
+				}
+			}
+
+			output := opts.output
+			if opts.merge && !cmd.Flags().Changed("output") {
+				if output, err = kubeconfig.DefaultPath(); err != nil {
+					return err
+				}
+			}
+			return etcd.GenerateKubeconfig(output, serverURL, store.PKIDir(sess), kubeconfigOpts)
+		},
+	}
+
+	opts.addFlags(cmd)
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "kubeconfig", "path of the kubeconfig file to write")
+	cmd.Flags().StringVar(&opts.server, "server", "", "kube-apiserver URL (defaults to https://127.0.0.1:<session port>, or the host IP with host networking)")
+	cmd.Flags().BoolVar(&opts.merge, "merge", false, "merge the context into the kubeconfig instead of overwriting it (defaults to $KUBECONFIG or ~/.kube/config)")
+
+	return cmd
+}
+
+// newCredentialCommand prints the credentials of a session for the exec credential
+// plugin of kubeconfigs written with --kubeconfig-user exec.
+func newCredentialCommand(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "credential",
+		Short: "Print the client certificate of a session as an ExecCredential",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The output is read by kubectl, so the session is not created on demand
+			store, err := sessionStore()
+			if err != nil {
+				return err
+			}
+			name := g.sessionName
+			if name == "" {
+				if name, err = store.Current(); err != nil {
+					return err
+				}
+			}
+			sess, err := store.Get(name)
+			if err != nil {
+				return err
+			}
+
+			credential, err := etcd.ExecCredential(store.PKIDir(sess), sess.ReadOnly)
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(credential)
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/s3"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot"
+)
+
+// listRemoteOptions holds the flags of the list-remote command.
+type listRemoteOptions struct {
+	all    bool
+	output string
+}
+
+func newListRemoteCommand(g *globalOptions) *cobra.Command {
+	opts := listRemoteOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "list-remote <s3://bucket/prefix>",
+		Short: "List the snapshots stored in an S3-compatible bucket, newest first",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bucket, prefix, err := s3.ParseURL(args[0])
+			if err != nil {
+				return err
+			}
+
+			client, err := s3.NewClient(g.s3)
+			if err != nil {
+				return err
+			}
+			objects, err := client.List(cmd.Context(), bucket, prefix)
+			if err != nil {
+				return err
+			}
+
+			// RKE2 and k3s upload a metadata sidecar next to every snapshot
+			snapshots := []s3.Object{}
+			for _, object := range objects {
+				if opts.all || !snapshot.IsMetadataFile(object.Key) {
+					snapshots = append(snapshots, object)
+				}
+			}
+
+			switch opts.output {
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(snapshots)
+			case "table":
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "KEY\tSIZE\tLAST_MODIFIED")
+				for _, object := range snapshots {
+					fmt.Fprintf(w, "s3://%s/%s\t%d\t%s\n", bucket, object.Key, object.Size, object.LastModified.UTC().Format(time.RFC3339))
+				}
+				return w.Flush()
+			default:
+				return fmt.Errorf("unsupported output format %q (expected table or json)", opts.output)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.all, "all", false, "also list metadata files such as .json sidecars")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "table", "output format: table or json")
+
+	return cmd
+}
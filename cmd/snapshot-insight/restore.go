@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/etcd"
+	"github.com/supporttools/snapshot-insight/pkg/s3"
+)
+
+// restoreOptions holds the flags of the restore command.
+type restoreOptions struct {
+	containerName string
+	volumeName    string
+}
+
+func newRestoreCommand(g *globalOptions) *cobra.Command {
+	opts := restoreOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "restore <path-to-snapshot|s3://bucket/key>",
+		Short: "Restore an etcd snapshot into a volume",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, sess, err := loadSession(g)
+			if err != nil {
+				return err
+			}
+			sessionDefault(cmd, "container-name", &opts.containerName, sess.EtcdContainer)
+			sessionDefault(cmd, "volume-name", &opts.volumeName, sess.EtcdVolume)
+
+			localPath, cleanup, err := fetchSnapshot(cmd.Context(), g, args[0])
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			// Container runtimes only accept absolute paths for bind mounts
+			snapshotPath, err := filepath.Abs(localPath)
+			if err != nil {
+				return fmt.Errorf("failed to resolve snapshot path %s: %v", localPath, err)
+			}
+
+			if err := etcd.RestoreEtcdSnapshot(cmd.Context(), g.runtime, snapshotPath, opts.containerName, opts.volumeName, g.images); err != nil {
+				return err
+			}
+
+			// Remember the snapshot so that start can match its Kubernetes version
+			sess.Snapshot = args[0]
+			if !s3.IsURL(args[0]) {
+				sess.Snapshot = snapshotPath
+			}
+			return store.Save(sess)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.containerName, "container-name", etcd.DefaultEtcdContainerName, "name of the temporary restore container (defaults to the session's)")
+	cmd.Flags().StringVar(&opts.volumeName, "volume-name", etcd.DefaultEtcdVolumeName, "volume receiving the restored etcd data (defaults to the session's)")
+
+	return cmd
+}
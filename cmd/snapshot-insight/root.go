@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/container"
+	"github.com/supporttools/snapshot-insight/pkg/etcd"
+	"github.com/supporttools/snapshot-insight/pkg/s3"
+)
+
+// globalOptions holds the flags shared by every command.
+type globalOptions struct {
+	runtimeName   string
+	runtime       container.Runtime
+	images        etcd.Images
+	imageRegistry string
+	pullPolicy    string
+	s3            s3.Options
+	sessionName   string
+
+	// apiServerImageSet is true when the kube-apiserver image was chosen explicitly.
+	apiServerImageSet bool
+}
+
+// newRootCommand builds the snapshot-insight command tree.
+func newRootCommand() *cobra.Command {
+	g := &globalOptions{}
+
+	rootCmd := &cobra.Command{
+		Use:   "snapshot-insight",
+		Short: "Explore Kubernetes etcd snapshots without restoring a full cluster",
+		Long: `Snapshot Insight restores an etcd snapshot into a standalone container,
+starts a kube-apiserver against the restored data and cleans everything up afterwards.`,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			rt, err := container.New(g.runtimeName)
+			if err != nil {
+				return err
+			}
+			g.runtime = rt
+			g.apiServerImageSet = cmd.Flags().Changed("apiserver-image") || os.Getenv("SNAPSHOT_INSIGHT_APISERVER_IMAGE") != ""
+
+			if g.images.PullPolicy, err = etcd.ParsePullPolicy(g.pullPolicy); err != nil {
+				return err
+			}
+			g.images = g.images.WithRegistry(g.imageRegistry)
+			return g.images.Validate()
+		},
+	}
+
+	rootCmd.PersistentFlags().StringVar(&g.sessionName, "session", os.Getenv("SNAPSHOT_INSIGHT_SESSION"), "session to use instead of the current one (env SNAPSHOT_INSIGHT_SESSION)")
+	rootCmd.PersistentFlags().StringVar(&g.runtimeName, "runtime", envOrDefault("SNAPSHOT_INSIGHT_RUNTIME", etcd.DefaultRuntime), "container runtime to use: docker, podman or nerdctl (env SNAPSHOT_INSIGHT_RUNTIME)")
+	rootCmd.PersistentFlags().StringVar(&g.images.Etcd, "etcd-image", envOrDefault("SNAPSHOT_INSIGHT_ETCD_IMAGE", etcd.DefaultEtcdImage), "etcd image, optionally pinned by digest (env SNAPSHOT_INSIGHT_ETCD_IMAGE)")
+	rootCmd.PersistentFlags().StringVar(&g.images.KubeAPIServer, "apiserver-image", envOrDefault("SNAPSHOT_INSIGHT_APISERVER_IMAGE", etcd.DefaultKubeAPIServerImage), "kube-apiserver image, optionally pinned by digest (env SNAPSHOT_INSIGHT_APISERVER_IMAGE)")
+	rootCmd.PersistentFlags().StringVar(&g.images.Helper, "helper-image", envOrDefault("SNAPSHOT_INSIGHT_HELPER_IMAGE", etcd.DefaultHelperImage), "image used to copy files into volumes (env SNAPSHOT_INSIGHT_HELPER_IMAGE)")
+	rootCmd.PersistentFlags().StringVar(&g.imageRegistry, "image-registry", os.Getenv("SNAPSHOT_INSIGHT_IMAGE_REGISTRY"), "registry mirror replacing the registry of every image (env SNAPSHOT_INSIGHT_IMAGE_REGISTRY)")
+	rootCmd.PersistentFlags().StringVar(&g.pullPolicy, "pull-policy", envOrDefault("SNAPSHOT_INSIGHT_PULL_POLICY", string(etcd.PullIfNotPresent)), "when to pull images: always, if-not-present or never (env SNAPSHOT_INSIGHT_PULL_POLICY)")
+	rootCmd.PersistentFlags().StringVar(&g.s3.Endpoint, "s3-endpoint", envOrDefault("SNAPSHOT_INSIGHT_S3_ENDPOINT", s3.DefaultEndpoint), "S3 endpoint for s3:// snapshots; use an http:// URL to disable TLS (env SNAPSHOT_INSIGHT_S3_ENDPOINT)")
+	rootCmd.PersistentFlags().StringVar(&g.s3.Region, "s3-region", os.Getenv("AWS_REGION"), "S3 region (env AWS_REGION)")
+	rootCmd.PersistentFlags().StringVar(&g.s3.AccessKey, "s3-access-key", "", "S3 access key; defaults to the AWS/MinIO environment variables and ~/.aws/credentials")
+	rootCmd.PersistentFlags().StringVar(&g.s3.SecretKey, "s3-secret-key", "", "S3 secret key")
+	rootCmd.PersistentFlags().StringVar(&g.s3.SessionToken, "s3-session-token", "", "S3 session token for temporary credentials")
+	rootCmd.PersistentFlags().StringVar(&g.s3.CAFile, "s3-ca-file", "", "PEM bundle trusted for the S3 endpoint in addition to the system roots")
+
+	rootCmd.AddCommand(
+		newRestoreCommand(g),
+		newStartCommand(g),
+		newKubeconfigCommand(g),
+		newCredentialCommand(g),
+		newCleanupCommand(g),
+		newInspectCommand(g),
+		newGetCommand(g),
+		newHistoryCommand(g),
+		newDiffCommand(g),
+		newVerifyCommand(g),
+		newListRemoteCommand(g),
+		newImagesCommand(g),
+		newDetectVersionCommand(g),
+		newEncryptionConfigCommand(),
+		newSessionsCommand(g),
+	)
+
+	return rootCmd
+}
+
+// envOrDefault returns the value of the environment variable key, or def when it is unset.
+func envOrDefault(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return def
+}
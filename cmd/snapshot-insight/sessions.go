@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/etcd"
+	"github.com/supporttools/snapshot-insight/pkg/session"
+)
+
+func newSessionsCommand(g *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Manage named sessions to run several snapshots side by side",
+		Long: `A session owns its own containers, volumes and ports, so that several snapshots can be
+restored and served at the same time. Commands use the session selected with --session, or
+the current one set with "sessions use"; the "default" session keeps the standard names and ports.`,
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the sessions",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				store, err := sessionStore()
+				if err != nil {
+					return err
+				}
+				sessions, err := store.List()
+				if err != nil {
+					return err
+				}
+				current, err := store.Current()
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "CURRENT\tNAME\tNETWORK\tETCD\tAPISERVER\tACCESS\tSNAPSHOT\tCREATED")
+				for _, sess := range sessions {
+					marker := ""
+					if sess.Name == current {
+						marker = "*"
+					}
+					snapshotPath := sess.Snapshot
+					if snapshotPath == "" {
+						snapshotPath = "-"
+					}
+					access := "read-write"
+					if sess.ReadOnly {
+						access = "read-only"
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", marker, sess.Name, sess.Network.Mode, sess.Ports.EtcdEndpoint(sess.EtcdTLS), sess.Ports.KubeAPIServerURL(), access, snapshotPath, sess.CreatedAt.Format(time.RFC3339))
+				}
+				return w.Flush()
+			},
+		},
+		&cobra.Command{
+			Use:   "use <name>",
+			Short: "Select the session used by other commands, creating it if needed",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				store, err := sessionStore()
+				if err != nil {
+					return err
+				}
+				sess, created, err := store.GetOrCreate(args[0])
+				if err != nil {
+					return err
+				}
+				if err := store.Use(sess.Name); err != nil {
+					return err
+				}
+
+				if created {
+					fmt.Printf("Created session %s (etcd %s, kube-apiserver %s)\n", sess.Name, sess.Ports.EtcdEndpoint(sess.EtcdTLS), sess.Ports.KubeAPIServerURL())
+				}
+				fmt.Printf("Using session %s\n", sess.Name)
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "rm <name>...",
+			Short: "Remove the containers, volumes and state of sessions",
+			Args:  cobra.MinimumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				store, err := sessionStore()
+				if err != nil {
+					return err
+				}
+
+				var errs []error
+				for _, name := range args {
+					sess, err := store.Get(name)
+					if err != nil {
+						errs = append(errs, err)
+						continue
+					}
+
+					// Containers and volumes may already be gone, only the state has to be removed
+					_ = etcd.CleanupKubeAPIServer(cmd.Context(), g.runtime, sess.APIServerContainer)
+					_ = etcd.CleanupEtcd(cmd.Context(), g.runtime, sess.EtcdContainer)
+					_ = etcd.CleanupNetwork(cmd.Context(), g.runtime, sess.Network.Name)
+					_ = etcd.CleanupVolume(cmd.Context(), g.runtime, sess.EtcdVolume)
+					_ = etcd.CleanupVolume(cmd.Context(), g.runtime, sess.CertsVolume)
+					if err := store.Remove(sess.Name); err != nil {
+						errs = append(errs, err)
+						continue
+					}
+					fmt.Printf("Removed session %s\n", sess.Name)
+				}
+				return errors.Join(errs...)
+			},
+		},
+	)
+
+	return cmd
+}
+
+// sessionStore returns the store in the snapshot-insight state directory.
+func sessionStore() (*session.Store, error) {
+	dir, err := session.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return &session.Store{Dir: dir}, nil
+}
+
+// loadSession returns the session selected with --session, or the current session,
+// creating it on first use.
+func loadSession(g *globalOptions) (*session.Store, *session.Session, error) {
+	store, err := sessionStore()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := g.sessionName
+	if name == "" {
+		if name, err = store.Current(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sess, created, err := store.GetOrCreate(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if created {
+		fmt.Printf("Created session %s (etcd %s, kube-apiserver %s)\n", sess.Name, sess.Ports.EtcdEndpoint(sess.EtcdTLS), sess.Ports.KubeAPIServerURL())
+	}
+	return store, sess, nil
+}
+
+// sessionDefault sets a name flag to the session's value unless it was given explicitly.
+func sessionDefault(cmd *cobra.Command, flag string, value *string, sessionValue string) {
+	if !cmd.Flags().Changed(flag) {
+		*value = sessionValue
+	}
+}
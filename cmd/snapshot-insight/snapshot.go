@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/supporttools/snapshot-insight/pkg/s3"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot"
+)
+
+// fetchSnapshot downloads s3:// snapshot arguments into a temporary directory and
+// returns local paths unchanged. The returned function removes the download.
+func fetchSnapshot(ctx context.Context, g *globalOptions, snapshotPath string) (string, func(), error) {
+	if !s3.IsURL(snapshotPath) {
+		return snapshotPath, func() {}, nil
+	}
+
+	bucket, key, err := s3.ParseURL(snapshotPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if key == "" {
+		return "", nil, fmt.Errorf("s3 URL %s does not name an object; use list-remote to find one", snapshotPath)
+	}
+
+	client, err := s3.NewClient(g.s3)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "snapshot-insight-s3-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	localPath := filepath.Join(dir, path.Base(key))
+	fmt.Fprintf(os.Stderr, "Downloading %s\n", snapshotPath)
+	if err := client.Download(ctx, bucket, key, localPath); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return localPath, cleanup, nil
+}
+
+// prepareSnapshot fetches and unwraps a compressed or archived snapshot and
+// reports what was extracted on stderr, keeping stdout clean for structured
+// output. The returned function removes any temporary files.
+func prepareSnapshot(ctx context.Context, g *globalOptions, snapshotPath string) (*snapshot.Prepared, func(), error) {
+	localPath, cleanup, err := fetchSnapshot(ctx, g, snapshotPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prepared, err := snapshot.Prepare(localPath)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	for _, step := range prepared.Steps {
+		fmt.Fprintf(os.Stderr, "snapshot input: %s\n", step)
+	}
+	return prepared, func() {
+		prepared.Close()
+		cleanup()
+	}, nil
+}
+
+// openSnapshot prepares and opens a snapshot read-only. The returned function
+// closes the snapshot and removes any temporary files.
+func openSnapshot(ctx context.Context, g *globalOptions, snapshotPath string) (*snapshot.Snapshot, func(), error) {
+	prepared, cleanup, err := prepareSnapshot(ctx, g, snapshotPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snap, err := snapshot.Open(prepared.Path)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return snap, func() {
+		snap.Close()
+		cleanup()
+	}, nil
+}
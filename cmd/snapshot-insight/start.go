@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/etcd"
+	"github.com/supporttools/snapshot-insight/pkg/kubeconfig"
+	"github.com/supporttools/snapshot-insight/pkg/s3"
+)
+
+// startOptions holds the flags of the start command.
+type startOptions struct {
+	kubeconfigFlags
+	etcdContainerName      string
+	etcdVolumeName         string
+	apiServerContainerName string
+	certsVolumeName        string
+	networkMode            string
+	networkName            string
+	etcdPort               int
+	apiServerPort          int
+	outputDir              string
+	snapshotPath           string
+	kubeVersion            string
+	encryptionConfig       string
+	encryptionBackup       string
+	etcdTLS                bool
+	pki                    etcd.PKIOptions
+	pkiBackup              string
+	keyAlgorithm           string
+	certSANs               []string
+	kubeconfigPath         string
+	mergeKubeconfig        bool
+	readOnly               bool
+	disableWebhooks        bool
+	localAPIServices       bool
+	waitTimeout            time.Duration
+}
+
+func newStartCommand(g *globalOptions) *cobra.Command {
+	opts := startOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Start etcd and a kube-apiserver against the restored data",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.localAPIServices && opts.waitTimeout <= 0 {
+				return fmt.Errorf("--local-apiservices needs a positive --wait-timeout")
+			}
+			store, sess, err := loadSession(g)
+			if err != nil {
+				return err
+			}
+			sessionDefault(cmd, "etcd-container-name", &opts.etcdContainerName, sess.EtcdContainer)
+			sessionDefault(cmd, "etcd-volume-name", &opts.etcdVolumeName, sess.EtcdVolume)
+			sessionDefault(cmd, "apiserver-container-name", &opts.apiServerContainerName, sess.APIServerContainer)
+			sessionDefault(cmd, "certs-volume-name", &opts.certsVolumeName, sess.CertsVolume)
+			sessionDefault(cmd, "network-name", &opts.networkName, sess.Network.Name)
+
+			// Remember the network, ports and TLS setting so that kubeconfig, cleanup and sessions find them
+			if cmd.Flags().Changed("network-mode") {
+				if sess.Network.Mode, err = etcd.ParseNetworkMode(opts.networkMode); err != nil {
+					return err
+				}
+			}
+			sess.Network.Name = opts.networkName
+			if cmd.Flags().Changed("etcd-port") {
+				sess.Ports.EtcdClient = opts.etcdPort
+			}
+			if cmd.Flags().Changed("apiserver-port") {
+				sess.Ports.KubeAPIServer = opts.apiServerPort
+			}
+			sess.EtcdTLS = opts.etcdTLS
+			if opts.outputDir == "" {
+				opts.outputDir = store.SessionDir(sess.Name)
+			}
+			// The kubeconfig command and the exec credential plugin read the certificates from here
+			pkiDir := filepath.Join(opts.outputDir, "pki")
+			sess.ReadOnly = opts.readOnly
+			sess.PKIDir = ""
+			if pkiDir != store.PKIDir(sess) {
+				sess.PKIDir = pkiDir
+			}
+			if err := store.Save(sess); err != nil {
+				return err
+			}
+			kubeconfigOpts, err := opts.options(sess)
+			if err != nil {
+				return err
+			}
+			// Match the version of the snapshot restored into the session when it is still on disk
+			if opts.snapshotPath == "" && sess.Snapshot != "" && !s3.IsURL(sess.Snapshot) {
+				if _, err := os.Stat(sess.Snapshot); err == nil {
+					opts.snapshotPath = sess.Snapshot
+				}
+			}
+
+			apiServerImage, err := resolveKubeAPIServerImage(cmd.Context(), g, os.Stdout, opts.kubeVersion, opts.snapshotPath)
+			if err != nil {
+				return err
+			}
+			images := g.images
+			images.KubeAPIServer = apiServerImage
+
+			encryptionConfig := opts.encryptionConfig
+			if opts.encryptionBackup != "" {
+				encryptionConfig = filepath.Join(opts.outputDir, "encryption-config.json")
+				if err := importEncryptionConfig(opts.encryptionBackup, encryptionConfig); err != nil {
+					return err
+				}
+			}
+
+			hostIP, err := etcd.HostIPAddress()
+			if err != nil {
+				return fmt.Errorf("failed to resolve host IP address: %v", err)
+			}
+
+			// The certificates are generated first as etcd serves them with --etcd-tls
+			if opts.pkiBackup != "" {
+				if err := opts.pki.ImportBackup(opts.pkiBackup); err != nil {
+					return fmt.Errorf("failed to import PKI: %v", err)
+				}
+			}
+			if opts.pki.Certs.KeyAlgorithm, err = etcd.ParseKeyAlgorithm(opts.keyAlgorithm); err != nil {
+				return err
+			}
+			opts.pki.Certs.AddSANs(opts.certSANs...)
+			var etcdTLS *etcd.EtcdTLS
+			if opts.etcdTLS {
+				etcdTLS = &etcd.EtcdTLS{CertsVolume: opts.certsVolumeName, PKIDir: pkiDir}
+				opts.pki.EtcdHosts = []string{opts.etcdContainerName}
+			}
+			if err := etcd.GeneratePKIInVolume(cmd.Context(), g.runtime, opts.certsVolumeName, pkiDir, hostIP, opts.pki, images); err != nil {
+				return fmt.Errorf("error generating certificates: %v", err)
+			}
+
+			// Each step rolls back its own resources; those of the earlier steps are removed here
+			createsNetwork := !sess.Network.IsHost() && !g.runtime.NetworkExists(cmd.Context(), sess.Network.Name)
+			etcdOpts := etcd.EtcdServerOptions{EtcdTLS: etcdTLS, Network: sess.Network, Ports: sess.Ports, Images: images, ReadyTimeout: opts.waitTimeout}
+			if err := etcd.StartEtcdServer(cmd.Context(), g.runtime, opts.etcdVolumeName, opts.etcdContainerName, hostIP, etcdOpts); err != nil {
+				if cmd.Context().Err() != nil {
+					_ = etcd.CleanupVolume(context.WithoutCancel(cmd.Context()), g.runtime, opts.certsVolumeName)
+				}
+				return err
+			}
+
+			apiServerOpts := etcd.KubeAPIServerOptions{
+				ReadOnly:                 sess.ReadOnly,
+				DisableAdmissionWebhooks: opts.disableWebhooks,
+				LocalAPIServices:         opts.localAPIServices,
+				PKIDir:                   pkiDir,
+				OutputDir:                opts.outputDir,
+				EncryptionConfigPath:     encryptionConfig,
+				EtcdTLS:                  etcdTLS,
+				Network:                  sess.Network,
+				Ports:                    sess.Ports,
+				Images:                   images,
+				ReadyTimeout:             opts.waitTimeout,
+			}
+			if err := etcd.StartKubeAPIServer(cmd.Context(), g.runtime, sess.Network.EtcdEndpoint(opts.etcdContainerName, etcdTLS, sess.Ports), opts.apiServerContainerName, opts.certsVolumeName, hostIP, apiServerOpts); err != nil {
+				if cmd.Context().Err() != nil {
+					_ = etcd.CleanupEtcd(context.WithoutCancel(cmd.Context()), g.runtime, opts.etcdContainerName)
+					_ = etcd.CleanupVolume(context.WithoutCancel(cmd.Context()), g.runtime, opts.certsVolumeName)
+					if createsNetwork {
+						_ = etcd.CleanupNetwork(context.WithoutCancel(cmd.Context()), g.runtime, sess.Network.Name)
+					}
+				}
+				return err
+			}
+
+			serverURL := sess.Network.KubeAPIServerURL(hostIP, sess.Ports)
+			access := "read-write"
+			if sess.ReadOnly {
+				access = "read-only"
+			}
+			fmt.Printf("kube-apiserver of session %s is reachable at %s (%s)\n", sess.Name, serverURL, access)
+
+			if opts.kubeconfigPath == "" {
+				opts.kubeconfigPath = filepath.Join(opts.outputDir, "kubeconfig")
+			}
+			if err := etcd.GenerateKubeconfig(opts.kubeconfigPath, serverURL, pkiDir, kubeconfigOpts); err != nil {
+				return fmt.Errorf("failed to write kubeconfig: %v", err)
+			}
+			if opts.mergeKubeconfig {
+				path, err := kubeconfig.DefaultPath()
+				if err != nil {
+					return err
+				}
+				kubeconfigOpts.Merge = true
+				if err := etcd.GenerateKubeconfig(path, serverURL, pkiDir, kubeconfigOpts); err != nil {
+					return fmt.Errorf("failed to merge kubeconfig: %v", err)
+				}
+				fmt.Printf("Run: kubectl --context %s get namespaces\n", kubeconfigOpts.Context)
+			} else {
+				fmt.Printf("Run: KUBECONFIG=%s kubectl get namespaces\n", opts.kubeconfigPath)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.etcdContainerName, "etcd-container-name", etcd.DefaultEtcdContainerName, "name of the etcd container")
+	cmd.Flags().StringVar(&opts.etcdVolumeName, "etcd-volume-name", etcd.DefaultEtcdVolumeName, "volume holding the restored etcd data")
+	cmd.Flags().StringVar(&opts.apiServerContainerName, "apiserver-container-name", etcd.DefaultKubeAPIServerContainerName, "name of the kube-apiserver container")
+	cmd.Flags().StringVar(&opts.certsVolumeName, "certs-volume-name", etcd.DefaultCertsVolumeName, "volume holding the kube-apiserver certificates")
+	cmd.Flags().StringVar(&opts.networkMode, "network-mode", string(etcd.NetworkBridge), "bridge publishes the ports on 127.0.0.1 only, host listens on every interface (defaults to the session's)")
+	cmd.Flags().StringVar(&opts.networkName, "network-name", etcd.DefaultNetworkName, "network connecting etcd and kube-apiserver in bridge mode (defaults to the session's)")
+	cmd.Flags().IntVar(&opts.etcdPort, "etcd-port", etcd.DefaultEtcdClientPort, "host port of the etcd client URL (defaults to the session's)")
+	cmd.Flags().IntVar(&opts.apiServerPort, "apiserver-port", etcd.DefaultKubeAPIServerPort, "host port of kube-apiserver (defaults to the session's)")
+	cmd.Flags().StringVar(&opts.outputDir, "output-dir", "", "directory for generated files (defaults to the session directory)")
+	cmd.Flags().StringVar(&opts.snapshotPath, "snapshot", "", "snapshot the data was restored from, used to pick a matching kube-apiserver version (defaults to the session's)")
+	cmd.Flags().StringVar(&opts.kubeVersion, "kube-version", "", "kube-apiserver version to run, e.g. v1.28.5, overriding detection")
+	cmd.Flags().StringVar(&opts.encryptionConfig, "encryption-config", "", "EncryptionConfiguration of the source cluster; an identity-only one is generated when unset")
+	cmd.Flags().StringVar(&opts.encryptionBackup, "import-encryption-config", "", "RKE2, k3s or kubeadm node backup to import the encryption configuration from")
+	cmd.Flags().BoolVar(&opts.etcdTLS, "etcd-tls", false, "serve etcd over TLS with client certificate authentication, signed by the kube-apiserver CA")
+	cmd.Flags().StringVar(&opts.keyAlgorithm, "cert-key-algorithm", string(etcd.KeyECDSAP256), fmt.Sprintf("key algorithm of the generated certificates, one of %v", etcd.KeyAlgorithms))
+	cmd.Flags().DurationVar(&opts.pki.Certs.Validity, "cert-validity", 0, fmt.Sprintf("lifetime of the generated certificates (defaults to %s, or %s when signed by an imported CA)", etcd.DefaultCertValidity, etcd.ImportedCACertValidity))
+	cmd.Flags().StringSliceVar(&opts.certSANs, "cert-san", nil, "extra DNS name or IP address of the kube-apiserver serving certificate, may be repeated")
+	cmd.Flags().StringVar(&opts.pki.CACert, "ca-cert", "", "CA certificate of the source cluster to sign the generated certificates with, so its client certificates stay valid")
+	cmd.Flags().StringVar(&opts.pki.CAKey, "ca-key", "", "private key of --ca-cert")
+	cmd.Flags().StringVar(&opts.pki.SAKey, "sa-key", "", "service account signing key of the source cluster, so its tokens stay valid")
+	cmd.Flags().StringVar(&opts.pki.SAPub, "sa-pub", "", "service account verification keys (defaults to the public key of --sa-key)")
+	cmd.Flags().StringVar(&opts.pkiBackup, "import-pki", "", "RKE2, k3s or kubeadm node backup to import the CA and service account keys from")
+	cmd.Flags().BoolVar(&opts.readOnly, "read-only", false, "reject every request that would change the restored data; the kubeconfig uses a viewer instead of the admin")
+	cmd.Flags().BoolVar(&opts.disableWebhooks, "disable-admission-webhooks", false, "do not call the admission webhooks restored from the snapshot, whose services are not running")
+	cmd.Flags().BoolVar(&opts.localAPIServices, "local-apiservices", false, "make APIServices of extension API servers such as metrics-server local-only, so discovery does not fail; changes the restored data")
+	opts.addFlags(cmd)
+	cmd.Flags().StringVar(&opts.kubeconfigPath, "kubeconfig", "", "path of the kubeconfig to write (defaults to kubeconfig in the output directory)")
+	cmd.Flags().BoolVar(&opts.mergeKubeconfig, "merge-kubeconfig", false, "also merge the context into $KUBECONFIG or ~/.kube/config and make it current")
+	cmd.Flags().DurationVar(&opts.waitTimeout, "wait-timeout", etcd.DefaultReadyTimeout, "how long to wait for etcd and kube-apiserver to become ready, 0 to not wait")
+	cmd.MarkFlagsMutuallyExclusive("encryption-config", "import-encryption-config")
+	cmd.MarkFlagsMutuallyExclusive("read-only", "local-apiservices")
+	cmd.MarkFlagsRequiredTogether("ca-cert", "ca-key")
+	for _, flag := range []string{"ca-cert", "sa-key", "sa-pub"} {
+		cmd.MarkFlagsMutuallyExclusive(flag, "import-pki")
+	}
+
+	return cmd
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot"
+)
+
+// verifyOptions holds the flags of the verify command.
+type verifyOptions struct {
+	output string
+}
+
+func newVerifyCommand(g *globalOptions) *cobra.Command {
+	opts := verifyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "verify <path-to-snapshot|s3://bucket/key>",
+		Short: "Check a snapshot's sha256 digest and bbolt structure",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prepared, cleanup, err := prepareSnapshot(cmd.Context(), g, args[0])
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			report, err := snapshot.Verify(prepared.Path)
+			if err != nil {
+				return err
+			}
+			report.Path = args[0]
+
+			switch opts.output {
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(report)
+			case "text":
+				fmt.Print(report)
+				fmt.Println("Snapshot is valid.")
+				return nil
+			default:
+				return fmt.Errorf("unsupported output format %q (expected text or json)", opts.output)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "text", "output format: text or json")
+
+	return cmd
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/supporttools/snapshot-insight/pkg/kubeversion"
+)
+
+// detectVersionOptions holds the flags of the detect-version command.
+type detectVersionOptions struct {
+	output string
+}
+
+func newDetectVersionCommand(g *globalOptions) *cobra.Command {
+	opts := detectVersionOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "detect-version <path-to-snapshot|s3://bucket/key>",
+		Short: "Infer the Kubernetes version of the cluster a snapshot was taken from",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result, err := detectVersion(cmd.Context(), g, args[0])
+			if err != nil {
+				return err
+			}
+
+			switch opts.output {
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(result)
+			case "text":
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "SOURCE\tVERSION\tDETAIL")
+				for _, evidence := range result.Evidence {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", evidence.Source, evidence.Version, evidence.Detail)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				fmt.Printf("\nDetected Kubernetes %s from %s\n", describeVersion(result), result.Source)
+				fmt.Printf("kube-apiserver image: %s\n", kubeversion.Image(g.images.KubeAPIServer, result.Version))
+				return nil
+			default:
+				return fmt.Errorf("unsupported output format %q (expected text or json)", opts.output)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "text", "output format: text or json")
+
+	return cmd
+}
+
+// detectVersion opens a snapshot and infers the source cluster version.
+func detectVersion(ctx context.Context, g *globalOptions, snapshotPath string) (*kubeversion.Result, error) {
+	snap, closeSnapshot, err := openSnapshot(ctx, g, snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSnapshot()
+
+	return kubeversion.Detect(snap)
+}
+
+// resolveKubeAPIServerImage picks the kube-apiserver image for start and images. An explicit
+// --kube-version wins, then an explicitly configured image, then the version
+// detected from the snapshot, reported on out; otherwise the configured default is kept.
+func resolveKubeAPIServerImage(ctx context.Context, g *globalOptions, out io.Writer, kubeVersion, snapshotPath string) (string, error) {
+	if kubeVersion != "" {
+		release, err := kubeversion.Normalize(kubeVersion)
+		if err != nil {
+			return "", err
+		}
+		return kubeversion.Image(g.images.KubeAPIServer, release), nil
+	}
+	if g.apiServerImageSet || snapshotPath == "" {
+		return g.images.KubeAPIServer, nil
+	}
+
+	result, err := detectVersion(ctx, g, snapshotPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect Kubernetes version (use --kube-version to set it): %v", err)
+	}
+	fmt.Fprintf(out, "Detected Kubernetes %s from %s\n", describeVersion(result), result.Source)
+	return kubeversion.Image(g.images.KubeAPIServer, result.Version), nil
+}
+
+// describeVersion renders a detected version, marking lower bounds.
+func describeVersion(result *kubeversion.Result) string {
+	if result.Exact {
+		return result.Version
+	}
+	return result.Version + " (lower bound)"
+}
@@ -0,0 +1,28 @@
+// Package backup locates files in backups of control plane nodes.
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Find resolves a path relative to a node root inside a backup that may start at any
+// directory of that path: for etc/kubernetes/pki/ca.crt it tries root/etc/kubernetes/pki/ca.crt,
+// root/kubernetes/pki/ca.crt and so on.
+func Find(root, rel string) (string, bool) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		path := filepath.Join(append([]string{root}, parts[i:]...)...)
+		if FileExists(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// FileExists reports whether path is a regular file.
+func FileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,28 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "kubernetes", "pki"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(root, "kubernetes", "pki", "ca.crt")
+	if err := os.WriteFile(want, []byte("ca"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := Find(root, "etc/kubernetes/pki/ca.crt"); !ok || got != want {
+		t.Errorf("Find() = %q, %v, want %q", got, ok, want)
+	}
+	if got, ok := Find(root, "etc/kubernetes/pki/ca.key"); ok {
+		t.Errorf("Find() found missing file at %q", got)
+	}
+	if got, ok := Find(root, "etc/kubernetes/pki"); ok {
+		t.Errorf("Find() returned directory %q", got)
+	}
+}
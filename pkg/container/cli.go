@@ -0,0 +1,191 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// waitDelay is how long an interrupted client may take to exit before it is killed.
+const waitDelay = 10 * time.Second
+
+// CLIRuntime drives a docker-compatible command line client.
+type CLIRuntime struct {
+	// Binary is the client executable, e.g. "docker" or "podman".
+	Binary string
+	// RelabelBindMounts appends ":z" to host bind mounts so they are readable under SELinux.
+	RelabelBindMounts bool
+	// Stdout and Stderr receive the output of long running commands such as pulls.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewDocker returns a runtime backed by the docker CLI.
+func NewDocker() *CLIRuntime {
+	return &CLIRuntime{Binary: "docker", Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+// NewPodman returns a runtime backed by the podman CLI.
+func NewPodman() *CLIRuntime {
+	// Podman hosts usually run with SELinux enforcing, which blocks unlabeled bind mounts
+	return &CLIRuntime{Binary: "podman", RelabelBindMounts: true, Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+// NewNerdctl returns a runtime backed by the nerdctl CLI for containerd.
+func NewNerdctl() *CLIRuntime {
+	return &CLIRuntime{Binary: "nerdctl", Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+// Name returns the name of the client executable.
+func (r *CLIRuntime) Name() string {
+	return r.Binary
+}
+
+// Pull pulls an image from its registry.
+func (r *CLIRuntime) Pull(ctx context.Context, image string) error {
+	return r.stream(ctx, "pull", image)
+}
+
+// ImageExists reports whether an image is present locally.
+func (r *CLIRuntime) ImageExists(ctx context.Context, image string) bool {
+	_, err := r.output(ctx, "image", "inspect", image)
+	return err == nil
+}
+
+// Load imports the images of a tarball.
+func (r *CLIRuntime) Load(ctx context.Context, tarball string) error {
+	return r.stream(ctx, "load", "-i", tarball)
+}
+
+// Run creates and starts a container.
+func (r *CLIRuntime) Run(ctx context.Context, opts RunOptions) (string, error) {
+	if r.RelabelBindMounts {
+		opts.Volumes = relabel(opts.Volumes)
+	}
+
+	if !opts.Detach {
+		return "", r.stream(ctx, opts.Args()...)
+	}
+	return r.output(ctx, opts.Args()...)
+}
+
+// Remove force-removes a container.
+func (r *CLIRuntime) Remove(ctx context.Context, name string) error {
+	_, err := r.output(ctx, "rm", "-f", name)
+	return err
+}
+
+// VolumeCreate creates a named volume.
+func (r *CLIRuntime) VolumeCreate(ctx context.Context, name string) error {
+	_, err := r.output(ctx, "volume", "create", name)
+	return err
+}
+
+// VolumeRemove removes a named volume.
+func (r *CLIRuntime) VolumeRemove(ctx context.Context, name string) error {
+	_, err := r.output(ctx, "volume", "rm", name)
+	return err
+}
+
+// Copy copies files between a container and the host.
+func (r *CLIRuntime) Copy(ctx context.Context, src, dst string) error {
+	_, err := r.output(ctx, "cp", src, dst)
+	return err
+}
+
+// Logs returns the logs of a container.
+func (r *CLIRuntime) Logs(ctx context.Context, name string, tail int) (string, error) {
+	args := []string{"logs"}
+	if tail > 0 {
+		args = append(args, "--tail", fmt.Sprint(tail))
+	}
+	return r.output(ctx, append(args, name)...)
+}
+
+// Inspect returns the raw JSON description of a container.
+func (r *CLIRuntime) Inspect(ctx context.Context, name string) (string, error) {
+	return r.output(ctx, "inspect", name)
+}
+
+// NetworkExists reports whether a named network exists.
+func (r *CLIRuntime) NetworkExists(ctx context.Context, name string) bool {
+	_, err := r.output(ctx, "network", "inspect", name)
+	return err == nil
+}
+
+// NetworkCreate creates a named bridge network.
+func (r *CLIRuntime) NetworkCreate(ctx context.Context, name string) error {
+	_, err := r.output(ctx, "network", "create", name)
+	return err
+}
+
+// NetworkRemove removes a named network.
+func (r *CLIRuntime) NetworkRemove(ctx context.Context, name string) error {
+	_, err := r.output(ctx, "network", "rm", name)
+	return err
+}
+
+// stream runs the client with its output attached to the runtime's writers.
+func (r *CLIRuntime) stream(ctx context.Context, args ...string) error {
+	cmd := r.command(ctx, args...)
+	cmd.Stdout = r.Stdout
+	cmd.Stderr = r.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s %s: %w", r.Binary, args[0], ctx.Err())
+		}
+		return fmt.Errorf("%s %s: %v", r.Binary, args[0], err)
+	}
+	return nil
+}
+
+// output runs the client and returns its combined output, which is also included in any error.
+func (r *CLIRuntime) output(ctx context.Context, args ...string) (string, error) {
+	var buf bytes.Buffer
+	cmd := r.command(ctx, args...)
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return buf.String(), fmt.Errorf("%s %s: %w", r.Binary, args[0], ctx.Err())
+		}
+		return buf.String(), fmt.Errorf("%s %s: %v: %s", r.Binary, args[0], err, strings.TrimSpace(buf.String()))
+	}
+	return buf.String(), nil
+}
+
+// command prepares the client to run until ctx is cancelled. The client is
+// interrupted rather than killed so that it can stop what it started, such as an
+// attached container, and is killed if it has not exited after waitDelay.
+func (r *CLIRuntime) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, r.Binary, args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+// relabel adds the shared SELinux relabel option to host bind mounts, appending it to
+// the options of mounts that already have some, such as ro.
+func relabel(volumes []string) []string {
+	labeled := make([]string, 0, len(volumes))
+	for _, volume := range volumes {
+		if strings.HasPrefix(volume, "/") {
+			switch parts := strings.Split(volume, ":"); len(parts) {
+			case 2:
+				volume += ":z"
+			case 3:
+				// Keep a relabel option that is already set
+				if options := "," + parts[2] + ","; !strings.Contains(options, ",z,") && !strings.Contains(options, ",Z,") {
+					volume += ",z"
+				}
+			}
+		}
+		labeled = append(labeled, volume)
+	}
+	return labeled
+}
@@ -0,0 +1,200 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Call is a single operation recorded by Fake.
+type Call struct {
+	// Op is the operation name: pull, image-exists, load, run, rm, volume-create, volume-rm, cp, logs, inspect,
+	// network-exists, network-create or network-rm.
+	Op string
+	// Args are the operation arguments; for run they are the docker-compatible run arguments.
+	Args []string
+}
+
+// String renders the call the way it would appear on a docker command line.
+func (c Call) String() string {
+	return strings.TrimSpace(c.Op + " " + strings.Join(c.Args, " "))
+}
+
+// Fake is an in-memory Runtime that records every call instead of running containers.
+type Fake struct {
+	mu sync.Mutex
+
+	// Calls holds the recorded operations in order.
+	Calls []Call
+	// Errors makes the operation with the given name fail.
+	Errors map[string]error
+	// Files holds the content returned by Copy, keyed by "container:path" source.
+	Files map[string][]byte
+	// Hooks are called when the operation with the given name is recorded, e.g. to
+	// cancel a context part way through. They must not call the Fake.
+	Hooks map[string]func()
+	// Images holds the images reported as present by ImageExists.
+	Images map[string]bool
+	// Networks holds the networks reported as present by NetworkExists.
+	Networks map[string]bool
+	// RunOutput is returned by detached runs.
+	RunOutput string
+	// LogsOutput is returned by Logs.
+	LogsOutput string
+	// InspectOutput is returned by Inspect.
+	InspectOutput string
+}
+
+// NewFake returns an empty fake runtime.
+func NewFake() *Fake {
+	return &Fake{Errors: map[string]error{}, Hooks: map[string]func(){}, Files: map[string][]byte{}, Images: map[string]bool{}, Networks: map[string]bool{}}
+}
+
+// Name returns "fake".
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Pull records an image pull.
+func (f *Fake) Pull(ctx context.Context, image string) error {
+	return f.record(ctx, "pull", image)
+}
+
+// ImageExists records an image lookup and reports whether the image is in Images.
+func (f *Fake) ImageExists(ctx context.Context, image string) bool {
+	if err := f.record(ctx, "image-exists", image); err != nil {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Images[image]
+}
+
+// Load records an image load.
+func (f *Fake) Load(ctx context.Context, tarball string) error {
+	return f.record(ctx, "load", tarball)
+}
+
+// Run records a container run.
+func (f *Fake) Run(ctx context.Context, opts RunOptions) (string, error) {
+	if err := f.record(ctx, "run", opts.Args()[1:]...); err != nil {
+		return "", err
+	}
+	if opts.Detach {
+		return f.RunOutput, nil
+	}
+	return "", nil
+}
+
+// Remove records a container removal.
+func (f *Fake) Remove(ctx context.Context, name string) error {
+	return f.record(ctx, "rm", name)
+}
+
+// VolumeCreate records a volume creation.
+func (f *Fake) VolumeCreate(ctx context.Context, name string) error {
+	return f.record(ctx, "volume-create", name)
+}
+
+// VolumeRemove records a volume removal.
+func (f *Fake) VolumeRemove(ctx context.Context, name string) error {
+	return f.record(ctx, "volume-rm", name)
+}
+
+// Copy records a copy and writes the matching entry of Files to dst.
+func (f *Fake) Copy(ctx context.Context, src, dst string) error {
+	if err := f.record(ctx, "cp", src, dst); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	data, ok := f.Files[src]
+	f.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("fake: no such file %s", src)
+	}
+	return os.WriteFile(dst, data, 0o600)
+}
+
+// Logs records a logs request.
+func (f *Fake) Logs(ctx context.Context, name string, tail int) (string, error) {
+	if err := f.record(ctx, "logs", name, fmt.Sprint(tail)); err != nil {
+		return "", err
+	}
+	return f.LogsOutput, nil
+}
+
+// Inspect records an inspect request.
+func (f *Fake) Inspect(ctx context.Context, name string) (string, error) {
+	if err := f.record(ctx, "inspect", name); err != nil {
+		return "", err
+	}
+	return f.InspectOutput, nil
+}
+
+// NetworkExists records a network lookup and reports whether the network is in Networks.
+func (f *Fake) NetworkExists(ctx context.Context, name string) bool {
+	if err := f.record(ctx, "network-exists", name); err != nil {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Networks[name]
+}
+
+// NetworkCreate records a network creation.
+func (f *Fake) NetworkCreate(ctx context.Context, name string) error {
+	return f.record(ctx, "network-create", name)
+}
+
+// NetworkRemove records a network removal.
+func (f *Fake) NetworkRemove(ctx context.Context, name string) error {
+	return f.record(ctx, "network-rm", name)
+}
+
+// Ops returns the recorded calls rendered as strings.
+func (f *Fake) Ops() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ops := make([]string, 0, len(f.Calls))
+	for _, call := range f.Calls {
+		ops = append(ops, call.String())
+	}
+	return ops
+}
+
+// CallsFor returns the recorded calls of a single operation.
+func (f *Fake) CallsFor(op string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []Call
+	for _, call := range f.Calls {
+		if call.Op == op {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// record appends a call and returns the error configured for the operation. The
+// call is recorded even when ctx is already cancelled, in which case ctx's error is
+// returned.
+func (f *Fake) record(ctx context.Context, op string, args ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Calls = append(f.Calls, Call{Op: op, Args: args})
+	if hook := f.Hooks[op]; hook != nil {
+		hook()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.Errors[op]
+}
@@ -0,0 +1,94 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Runtime is the set of container operations snapshot-insight relies on. Every
+// operation stops when its context is cancelled.
+type Runtime interface {
+	// Name returns the name of the runtime, e.g. "docker".
+	Name() string
+	// Pull pulls an image from its registry.
+	Pull(ctx context.Context, image string) error
+	// ImageExists reports whether an image is present in the local image store.
+	ImageExists(ctx context.Context, image string) bool
+	// Load imports the images of a "docker save" tarball into the local image store.
+	Load(ctx context.Context, tarball string) error
+	// Run creates and starts a container. Detached runs return the container ID.
+	Run(ctx context.Context, opts RunOptions) (string, error)
+	// Remove force-removes a container.
+	Remove(ctx context.Context, name string) error
+	// VolumeCreate creates a named volume.
+	VolumeCreate(ctx context.Context, name string) error
+	// VolumeRemove removes a named volume.
+	VolumeRemove(ctx context.Context, name string) error
+	// Copy copies files between a container and the host using "container:path" notation.
+	Copy(ctx context.Context, src, dst string) error
+	// Logs returns the last tail lines of a container's logs, or all of them if tail is zero.
+	Logs(ctx context.Context, name string, tail int) (string, error)
+	// Inspect returns the raw JSON description of a container.
+	Inspect(ctx context.Context, name string) (string, error)
+	// NetworkExists reports whether a named network exists.
+	NetworkExists(ctx context.Context, name string) bool
+	// NetworkCreate creates a named bridge network.
+	NetworkCreate(ctx context.Context, name string) error
+	// NetworkRemove removes a named network.
+	NetworkRemove(ctx context.Context, name string) error
+}
+
+// RunOptions describes a container to run.
+type RunOptions struct {
+	Name    string
+	Image   string
+	Detach  bool
+	Remove  bool
+	Network string
+	// Publish are "hostIP:hostPort:containerPort" port mappings.
+	Publish []string
+	// Volumes are "source:destination" mounts; sources starting with "/" are host paths.
+	Volumes []string
+	// Command is the command and arguments run inside the container.
+	Command []string
+}
+
+// Args returns the docker-compatible "run" arguments for the options.
+func (o RunOptions) Args() []string {
+	args := []string{"run"}
+	if o.Detach {
+		args = append(args, "-d")
+	}
+	if o.Remove {
+		args = append(args, "--rm")
+	}
+	if o.Name != "" {
+		args = append(args, "--name", o.Name)
+	}
+	if o.Network != "" {
+		args = append(args, "--network", o.Network)
+	}
+	for _, port := range o.Publish {
+		args = append(args, "-p", port)
+	}
+	for _, volume := range o.Volumes {
+		args = append(args, "-v", volume)
+	}
+	args = append(args, o.Image)
+	return append(args, o.Command...)
+}
+
+// New returns the runtime with the given name.
+func New(name string) (Runtime, error) {
+	switch strings.ToLower(name) {
+	case "docker", "":
+		return NewDocker(), nil
+	case "podman":
+		return NewPodman(), nil
+	case "nerdctl":
+		return NewNerdctl(), nil
+	default:
+		return nil, fmt.Errorf("unsupported container runtime %q (expected docker, podman or nerdctl)", name)
+	}
+}
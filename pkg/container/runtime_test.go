@@ -0,0 +1,87 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunOptionsArgs(t *testing.T) {
+	opts := RunOptions{
+		Name:    "etcd",
+		Image:   "etcd:test",
+		Detach:  true,
+		Remove:  true,
+		Network: "insight",
+		Publish: []string{"127.0.0.1:2379:2379"},
+		Volumes: []string{"data:/etcd-data", "/tmp/snapshot.db:/snapshot.db"},
+		Command: []string{"etcd", "--data-dir=/etcd-data"},
+	}
+
+	want := []string{"run", "-d", "--rm", "--name", "etcd", "--network", "insight",
+		"-p", "127.0.0.1:2379:2379", "-v", "data:/etcd-data", "-v", "/tmp/snapshot.db:/snapshot.db",
+		"etcd:test", "etcd", "--data-dir=/etcd-data"}
+	if got := opts.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() = %q, want %q", got, want)
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	got := relabel([]string{"data:/etcd-data", "certs:/certs:ro", "/tmp/snapshot.db:/snapshot.db", "/tmp/policy.jsonl:/etc/policy.jsonl:ro", "/tmp/config:/config:ro,Z"})
+	want := []string{"data:/etcd-data", "certs:/certs:ro", "/tmp/snapshot.db:/snapshot.db:z", "/tmp/policy.jsonl:/etc/policy.jsonl:ro,z", "/tmp/config:/config:ro,Z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("relabel() = %q, want %q", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "", want: "docker"},
+		{name: "docker", want: "docker"},
+		{name: "Podman", want: "podman"},
+		{name: "nerdctl", want: "nerdctl"},
+		{name: "lxc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		rt, err := New(tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("New(%q) expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("New(%q): %v", tt.name, err)
+		}
+		if rt.Name() != tt.want {
+			t.Errorf("New(%q).Name() = %s, want %s", tt.name, rt.Name(), tt.want)
+		}
+	}
+}
+
+func TestCLIRuntimeCancel(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+	// "sleep" stands in for a client stuck on a hung pull
+	rt := &CLIRuntime{Binary: "sleep"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := rt.output(ctx, "30")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("output() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelled command took %s to return", elapsed)
+	}
+}
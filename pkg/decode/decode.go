@@ -0,0 +1,196 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// protobufPrefix marks values stored with the Kubernetes protobuf envelope.
+	protobufPrefix = []byte("k8s\x00")
+
+	// encryptedPrefix marks values encrypted at rest by kube-apiserver.
+	encryptedPrefix = []byte("k8s:enc:")
+)
+
+var (
+	// ErrEncrypted is returned for values encrypted at rest.
+	ErrEncrypted = errors.New("value is encrypted at rest")
+
+	// ErrNotKubernetes is returned for values that are neither protobuf nor JSON objects.
+	ErrNotKubernetes = errors.New("value is not a Kubernetes object")
+)
+
+// scheme holds the types decoded into typed objects; anything else stays a runtime.Unknown.
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(appsv1.AddToScheme(scheme))
+}
+
+// Decode converts a raw etcd value into a Kubernetes object. Protobuf values of
+// types outside the built-in scheme are returned as *runtime.Unknown, JSON values
+// such as custom resources as *unstructured.Unstructured.
+func Decode(value []byte) (runtime.Object, error) {
+	switch {
+	case bytes.HasPrefix(value, encryptedPrefix):
+		return nil, ErrEncrypted
+	case bytes.HasPrefix(value, protobufPrefix):
+		return decodeProtobuf(value[len(protobufPrefix):])
+	case bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")):
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(value); err != nil {
+			return nil, fmt.Errorf("failed to decode JSON object: %v", err)
+		}
+		return obj, nil
+	default:
+		return nil, ErrNotKubernetes
+	}
+}
+
+// decodeProtobuf unwraps the runtime.Unknown envelope and decodes known types.
+func decodeProtobuf(data []byte) (runtime.Object, error) {
+	unknown := &runtime.Unknown{}
+	if err := unknown.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("failed to decode protobuf envelope: %v", err)
+	}
+	unknown.ContentType = runtime.ContentTypeProtobuf
+
+	gvk := schema.FromAPIVersionAndKind(unknown.APIVersion, unknown.Kind)
+	obj, err := scheme.New(gvk)
+	if err != nil {
+		return unknown, nil
+	}
+
+	message, ok := obj.(interface{ Unmarshal([]byte) error })
+	if !ok {
+		return unknown, nil
+	}
+	if err := message.Unmarshal(unknown.Raw); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", gvk, err)
+	}
+
+	// Protobuf payloads do not carry TypeMeta, restore it from the envelope
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	return obj, nil
+}
+
+// Identity names an object the way kubectl would.
+type Identity struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// Identify returns the apiVersion, kind, namespace and name of a decoded object.
+func Identify(obj runtime.Object) Identity {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	id := Identity{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind}
+
+	if unknown, ok := obj.(*runtime.Unknown); ok {
+		id.APIVersion, id.Kind = unknown.APIVersion, unknown.Kind
+		if objectMeta := unknownObjectMeta(unknown.Raw); objectMeta != nil {
+			id.Namespace, id.Name = objectMeta.Namespace, objectMeta.Name
+		}
+		return id
+	}
+
+	if accessor, err := meta.Accessor(obj); err == nil {
+		id.Namespace, id.Name = accessor.GetNamespace(), accessor.GetName()
+	}
+	return id
+}
+
+// ToJSON renders an object as indented JSON.
+func ToJSON(obj runtime.Object) ([]byte, error) {
+	return json.MarshalIndent(printable(obj), "", "  ")
+}
+
+// ToYAML renders an object as YAML.
+func ToYAML(obj runtime.Object) ([]byte, error) {
+	data, err := json.Marshal(printable(obj))
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(data)
+}
+
+// NewList wraps objects in a v1 List the way kubectl prints multiple objects.
+func NewList(objs []runtime.Object) runtime.Object {
+	list := &metav1.List{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+	for _, obj := range objs {
+		list.Items = append(list.Items, runtime.RawExtension{Object: obj})
+	}
+	return list
+}
+
+// printable converts an object into a value that marshals to readable JSON.
+func printable(obj runtime.Object) interface{} {
+	switch o := obj.(type) {
+	case *runtime.Unknown:
+		out := map[string]interface{}{
+			"apiVersion":  o.APIVersion,
+			"kind":        o.Kind,
+			"contentType": o.ContentType,
+			"raw":         o.Raw,
+		}
+		if objectMeta := unknownObjectMeta(o.Raw); objectMeta != nil {
+			out["metadata"] = objectMeta
+		}
+		return out
+	case *metav1.List:
+		items := make([]interface{}, 0, len(o.Items))
+		for _, item := range o.Items {
+			items = append(items, printable(item.Object))
+		}
+		return map[string]interface{}{"apiVersion": o.APIVersion, "kind": o.Kind, "items": items}
+	default:
+		return obj
+	}
+}
+
+// unknownObjectMeta extracts the metadata of an undecoded protobuf object. Every
+// Kubernetes top-level message stores its ObjectMeta as field 1.
+func unknownObjectMeta(raw []byte) *metav1.ObjectMeta {
+	for len(raw) > 0 {
+		num, typ, n := protowire.ConsumeTag(raw)
+		if n < 0 {
+			return nil
+		}
+		raw = raw[n:]
+
+		if num == 1 && typ == protowire.BytesType {
+			field, n := protowire.ConsumeBytes(raw)
+			if n < 0 {
+				return nil
+			}
+			objectMeta := &metav1.ObjectMeta{}
+			if err := objectMeta.Unmarshal(field); err != nil {
+				return nil
+			}
+			return objectMeta
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, raw)
+		if n < 0 {
+			return nil
+		}
+		raw = raw[n:]
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package decode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/snapshot/snapshottest"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDecode(t *testing.T) {
+	replicas := int32(3)
+	tests := []struct {
+		name     string
+		value    func(t *testing.T) []byte
+		wantType string
+		wantID   Identity
+		wantYAML []string
+		wantErr  error
+	}{
+		{
+			name: "core pod",
+			value: func(t *testing.T) []byte {
+				return snapshottest.Protobuf(t, &corev1.Pod{
+					TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+					ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: "kube-system"},
+					Spec:       corev1.PodSpec{NodeName: "node-1"},
+				})
+			},
+			wantType: "*v1.Pod",
+			wantID:   Identity{APIVersion: "v1", Kind: "Pod", Namespace: "kube-system", Name: "coredns"},
+			wantYAML: []string{"apiVersion: v1", "kind: Pod", "nodeName: node-1"},
+		},
+		{
+			name: "apps deployment",
+			value: func(t *testing.T) []byte {
+				return snapshottest.Protobuf(t, &appsv1.Deployment{
+					TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+					ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+					Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+				})
+			},
+			wantType: "*v1.Deployment",
+			wantID:   Identity{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "default", Name: "web"},
+			wantYAML: []string{"apiVersion: apps/v1", "kind: Deployment", "replicas: 3"},
+		},
+		{
+			name: "unregistered type stays unknown",
+			value: func(t *testing.T) []byte {
+				return snapshottest.Protobuf(t, &batchv1.Job{
+					TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+					ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "ops"},
+				})
+			},
+			wantType: "*runtime.Unknown",
+			wantID:   Identity{APIVersion: "batch/v1", Kind: "Job", Namespace: "ops", Name: "backup"},
+			wantYAML: []string{"apiVersion: batch/v1", "kind: Job", "contentType: application/vnd.kubernetes.protobuf", "name: backup"},
+		},
+		{
+			name: "custom resource stored as JSON",
+			value: func(t *testing.T) []byte {
+				return []byte(`{"apiVersion":"cert-manager.io/v1","kind":"Certificate","metadata":{"name":"tls","namespace":"web"},"spec":{"secretName":"tls"}}`)
+			},
+			wantType: "*unstructured.Unstructured",
+			wantID:   Identity{APIVersion: "cert-manager.io/v1", Kind: "Certificate", Namespace: "web", Name: "tls"},
+			wantYAML: []string{"kind: Certificate", "secretName: tls"},
+		},
+		{
+			name:    "encrypted",
+			value:   func(t *testing.T) []byte { return []byte("k8s:enc:aescbc:v1:key1:garbage") },
+			wantErr: ErrEncrypted,
+		},
+		{
+			name:    "plain value",
+			value:   func(t *testing.T) []byte { return []byte("10.0.0.1") },
+			wantErr: ErrNotKubernetes,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := Decode(tt.value(t))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+
+			if got := fmt.Sprintf("%T", obj); got != tt.wantType {
+				t.Errorf("Decode() type = %s, want %s", got, tt.wantType)
+			}
+			if got := Identify(obj); got != tt.wantID {
+				t.Errorf("Identify() = %+v, want %+v", got, tt.wantID)
+			}
+
+			data, err := ToYAML(obj)
+			if err != nil {
+				t.Fatalf("ToYAML: %v", err)
+			}
+			for _, want := range tt.wantYAML {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("YAML missing %q:\n%s", want, data)
+				}
+			}
+		})
+	}
+}
+
+func TestToJSONList(t *testing.T) {
+	pod := &corev1.Pod{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"}, ObjectMeta: metav1.ObjectMeta{Name: "a"}}
+	unknown := &runtime.Unknown{TypeMeta: runtime.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}}
+
+	data, err := ToJSON(NewList([]runtime.Object{pod, unknown}))
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	for _, want := range []string{`"kind": "List"`, `"kind": "Pod"`, `"kind": "Job"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON missing %s:\n%s", want, data)
+		}
+	}
+}
+
+func TestLookupResource(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		wantKey   string
+	}{
+		{name: "po", namespace: "kube-system", wantKey: "/registry/pods/kube-system/x"},
+		{name: "svc", namespace: "default", wantKey: "/registry/services/specs/default/x"},
+		{name: "nodes", namespace: "default", wantKey: "/registry/minions/x"},
+		{name: "Deployments", namespace: "web", wantKey: "/registry/deployments/web/x"},
+		{name: "certificates.cert-manager.io", namespace: "web", wantKey: "/registry/cert-manager.io/certificates/web/x"},
+		{name: "leases", namespace: "kube-node-lease", wantKey: "/registry/leases/kube-node-lease/x"},
+		{name: "clusterroles", namespace: "default", wantKey: "/registry/clusterroles/x"},
+		{name: "clusterrolebindings.rbac.authorization.k8s.io", namespace: "default", wantKey: "/registry/clusterrolebindings/x"},
+		{name: "sc", namespace: "default", wantKey: "/registry/storageclasses/x"},
+		{name: "priorityclasses", namespace: "default", wantKey: "/registry/priorityclasses/x"},
+		{name: "customresourcedefinitions.apiextensions.k8s.io", namespace: "default", wantKey: "/registry/apiextensions.k8s.io/customresourcedefinitions/x"},
+		{name: "validatingwebhookconfigurations", namespace: "default", wantKey: "/registry/validatingwebhookconfigurations/x"},
+		{name: "apiservices", namespace: "default", wantKey: "/registry/apiregistration.k8s.io/apiservices/x"},
+		{name: "csidrivers", namespace: "default", wantKey: "/registry/csidrivers/x"},
+		{name: "deployments.apps", namespace: "web", wantKey: "/registry/deployments/web/x"},
+		{name: "ing", namespace: "web", wantKey: "/registry/ingress/web/x"},
+		{name: "ingresses.networking.k8s.io", namespace: "web", wantKey: "/registry/ingress/web/x"},
+	}
+
+	for _, tt := range tests {
+		if got := LookupResource(tt.name).Key(tt.namespace, "x"); got != tt.wantKey {
+			t.Errorf("LookupResource(%q).Key() = %s, want %s", tt.name, got, tt.wantKey)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package decode
+
+import (
+	"strings"
+)
+
+// Resource maps a kubectl resource name to where kube-apiserver stores it in etcd.
+type Resource struct {
+	Name string
+	// Group is the API group, which may qualify the name as "<name>.<group>".
+	Group      string
+	Aliases    []string
+	Prefix     string
+	Namespaced bool
+}
+
+// resources lists the built-in resources whose etcd prefix differs from
+// /registry/<name>/, that have common short names or that are cluster-scoped.
+var resources = []Resource{
+	{Name: "pods", Aliases: []string{"pod", "po"}, Prefix: "/registry/pods/", Namespaced: true},
+	{Name: "services", Aliases: []string{"service", "svc"}, Prefix: "/registry/services/specs/", Namespaced: true},
+	{Name: "endpoints", Aliases: []string{"ep"}, Prefix: "/registry/services/endpoints/", Namespaced: true},
+	{Name: "configmaps", Aliases: []string{"configmap", "cm"}, Prefix: "/registry/configmaps/", Namespaced: true},
+	{Name: "secrets", Aliases: []string{"secret"}, Prefix: "/registry/secrets/", Namespaced: true},
+	{Name: "serviceaccounts", Aliases: []string{"serviceaccount", "sa"}, Prefix: "/registry/serviceaccounts/", Namespaced: true},
+	{Name: "persistentvolumeclaims", Aliases: []string{"persistentvolumeclaim", "pvc"}, Prefix: "/registry/persistentvolumeclaims/", Namespaced: true},
+	{Name: "events", Aliases: []string{"event", "ev"}, Prefix: "/registry/events/", Namespaced: true},
+	{Name: "limitranges", Aliases: []string{"limitrange", "limits"}, Prefix: "/registry/limitranges/", Namespaced: true},
+	{Name: "resourcequotas", Aliases: []string{"resourcequota", "quota"}, Prefix: "/registry/resourcequotas/", Namespaced: true},
+	{Name: "replicationcontrollers", Aliases: []string{"replicationcontroller", "rc"}, Prefix: "/registry/controllers/", Namespaced: true},
+	{Name: "namespaces", Aliases: []string{"namespace", "ns"}, Prefix: "/registry/namespaces/"},
+	{Name: "nodes", Aliases: []string{"node", "no"}, Prefix: "/registry/minions/"},
+	{Name: "persistentvolumes", Aliases: []string{"persistentvolume", "pv"}, Prefix: "/registry/persistentvolumes/"},
+	{Name: "deployments", Group: "apps", Aliases: []string{"deployment", "deploy"}, Prefix: "/registry/deployments/", Namespaced: true},
+	{Name: "replicasets", Group: "apps", Aliases: []string{"replicaset", "rs"}, Prefix: "/registry/replicasets/", Namespaced: true},
+	{Name: "statefulsets", Group: "apps", Aliases: []string{"statefulset", "sts"}, Prefix: "/registry/statefulsets/", Namespaced: true},
+	{Name: "daemonsets", Group: "apps", Aliases: []string{"daemonset", "ds"}, Prefix: "/registry/daemonsets/", Namespaced: true},
+	{Name: "controllerrevisions", Group: "apps", Aliases: []string{"controllerrevision"}, Prefix: "/registry/controllerrevisions/", Namespaced: true},
+
+	// Other built-in groups
+	{Name: "ingresses", Group: "networking.k8s.io", Aliases: []string{"ingress", "ing"}, Prefix: "/registry/ingress/", Namespaced: true},
+	{Name: "clusterroles", Group: "rbac.authorization.k8s.io", Aliases: []string{"clusterrole"}, Prefix: "/registry/clusterroles/"},
+	{Name: "clusterrolebindings", Group: "rbac.authorization.k8s.io", Aliases: []string{"clusterrolebinding"}, Prefix: "/registry/clusterrolebindings/"},
+	{Name: "roles", Group: "rbac.authorization.k8s.io", Aliases: []string{"role"}, Prefix: "/registry/roles/", Namespaced: true},
+	{Name: "rolebindings", Group: "rbac.authorization.k8s.io", Aliases: []string{"rolebinding"}, Prefix: "/registry/rolebindings/", Namespaced: true},
+	{Name: "storageclasses", Group: "storage.k8s.io", Aliases: []string{"storageclass", "sc"}, Prefix: "/registry/storageclasses/"},
+	{Name: "csidrivers", Group: "storage.k8s.io", Aliases: []string{"csidriver"}, Prefix: "/registry/csidrivers/"},
+	{Name: "csinodes", Group: "storage.k8s.io", Aliases: []string{"csinode"}, Prefix: "/registry/csinodes/"},
+	{Name: "volumeattachments", Group: "storage.k8s.io", Aliases: []string{"volumeattachment"}, Prefix: "/registry/volumeattachments/"},
+	{Name: "priorityclasses", Group: "scheduling.k8s.io", Aliases: []string{"priorityclass", "pc"}, Prefix: "/registry/priorityclasses/"},
+	{Name: "runtimeclasses", Group: "node.k8s.io", Aliases: []string{"runtimeclass"}, Prefix: "/registry/runtimeclasses/"},
+	{Name: "ingressclasses", Group: "networking.k8s.io", Aliases: []string{"ingressclass"}, Prefix: "/registry/ingressclasses/"},
+	{Name: "certificatesigningrequests", Group: "certificates.k8s.io", Aliases: []string{"certificatesigningrequest", "csr"}, Prefix: "/registry/certificatesigningrequests/"},
+	{Name: "customresourcedefinitions", Group: "apiextensions.k8s.io", Aliases: []string{"customresourcedefinition", "crd", "crds"}, Prefix: "/registry/apiextensions.k8s.io/customresourcedefinitions/"},
+	{Name: "apiservices", Group: "apiregistration.k8s.io", Aliases: []string{"apiservice"}, Prefix: "/registry/apiregistration.k8s.io/apiservices/"},
+	{Name: "mutatingwebhookconfigurations", Group: "admissionregistration.k8s.io", Aliases: []string{"mutatingwebhookconfiguration"}, Prefix: "/registry/mutatingwebhookconfigurations/"},
+	{Name: "validatingwebhookconfigurations", Group: "admissionregistration.k8s.io", Aliases: []string{"validatingwebhookconfiguration"}, Prefix: "/registry/validatingwebhookconfigurations/"},
+	{Name: "validatingadmissionpolicies", Group: "admissionregistration.k8s.io", Aliases: []string{"validatingadmissionpolicy"}, Prefix: "/registry/validatingadmissionpolicies/"},
+	{Name: "validatingadmissionpolicybindings", Group: "admissionregistration.k8s.io", Aliases: []string{"validatingadmissionpolicybinding"}, Prefix: "/registry/validatingadmissionpolicybindings/"},
+	{Name: "flowschemas", Group: "flowcontrol.apiserver.k8s.io", Aliases: []string{"flowschema"}, Prefix: "/registry/flowschemas/"},
+	{Name: "prioritylevelconfigurations", Group: "flowcontrol.apiserver.k8s.io", Aliases: []string{"prioritylevelconfiguration"}, Prefix: "/registry/prioritylevelconfigurations/"},
+}
+
+// LookupResource resolves a resource name, alias or "<plural>.<group>" to its
+// etcd location. Unknown names are assumed to be namespaced and stored under
+// /registry/<group>/<plural>/ like custom resources; cluster-scoped built-ins
+// must be listed in resources.
+func LookupResource(name string) Resource {
+	name = strings.ToLower(name)
+	for _, resource := range resources {
+		if resource.Name == name || (resource.Group != "" && resource.Name+"."+resource.Group == name) {
+			return resource
+		}
+		for _, alias := range resource.Aliases {
+			if alias == name {
+				return resource
+			}
+		}
+	}
+
+	if plural, group, ok := strings.Cut(name, "."); ok {
+		return Resource{Name: name, Prefix: "/registry/" + group + "/" + plural + "/", Namespaced: true}
+	}
+	return Resource{Name: name, Prefix: "/registry/" + name + "/", Namespaced: true}
+}
+
+// KeyPrefix returns the etcd prefix for objects of the resource in a namespace;
+// an empty namespace selects every namespace.
+func (r Resource) KeyPrefix(namespace string) string {
+	if !r.Namespaced || namespace == "" {
+		return r.Prefix
+	}
+	return r.Prefix + namespace + "/"
+}
+
+// Key returns the etcd key of a single object.
+func (r Resource) Key(namespace, name string) string {
+	if !r.Namespaced {
+		return r.Prefix + name
+	}
+	return r.Prefix + namespace + "/" + name
+}
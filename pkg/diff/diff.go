@@ -0,0 +1,273 @@
+// Package diff compares the Kubernetes objects of two snapshots field by field.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/supporttools/snapshot-insight/pkg/decode"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ChangeType is how an object or field differs between two snapshots.
+type ChangeType string
+
+const (
+	// Added objects are only in the second snapshot.
+	Added ChangeType = "added"
+	// Removed objects are only in the first snapshot.
+	Removed ChangeType = "removed"
+	// Modified objects are in both snapshots with different fields.
+	Modified ChangeType = "modified"
+)
+
+// DefaultIgnoredFields are left out of comparisons: they record which client last wrote a
+// field rather than the state of the object, and change along with every other field.
+var DefaultIgnoredFields = []string{"metadata.managedFields"}
+
+// Object is a decoded object of a snapshot, identified by its etcd key.
+type Object struct {
+	Key      string
+	Identity decode.Identity
+	// Content is the object as generic JSON values.
+	Content map[string]any
+}
+
+// NewObject converts a decoded object for comparison.
+func NewObject(key string, obj runtime.Object) (Object, error) {
+	data, err := decode.ToJSON(obj)
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to encode %s: %v", key, err)
+	}
+	content := map[string]any{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return Object{}, fmt.Errorf("failed to decode %s: %v", key, err)
+	}
+	return Object{Key: key, Identity: decode.Identify(obj), Content: content}, nil
+}
+
+// Change is an object that differs between two snapshots.
+type Change struct {
+	Type      ChangeType `json:"type"`
+	Group     string     `json:"group"`
+	Version   string     `json:"version"`
+	Kind      string     `json:"kind"`
+	Namespace string     `json:"namespace,omitempty"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key"`
+	// Fields lists the differing fields of a modified object.
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a field whose value differs. Type tells whether the field is only in one
+// snapshot, as Before and After may also be null for fields present in both.
+type FieldChange struct {
+	Path   string     `json:"path"`
+	Type   ChangeType `json:"type"`
+	Before any        `json:"before,omitempty"`
+	After  any        `json:"after,omitempty"`
+}
+
+// Compare returns the objects added, removed or modified from before to after, matched by
+// etcd key and sorted by group, kind, namespace and name. Fields whose paths are in ignored,
+// such as DefaultIgnoredFields, are not compared.
+func Compare(before, after []Object, ignored []string) []Change {
+	old := map[string]Object{}
+	for _, obj := range before {
+		old[obj.Key] = obj
+	}
+	skip := map[string]bool{}
+	for _, path := range ignored {
+		skip[path] = true
+	}
+
+	var changes []Change
+	for _, obj := range after {
+		previous, ok := old[obj.Key]
+		if !ok {
+			changes = append(changes, newChange(Added, obj))
+			continue
+		}
+		delete(old, obj.Key)
+
+		var fields []FieldChange
+		compareValues("", previous.Content, obj.Content, skip, &fields)
+		if len(fields) > 0 {
+			change := newChange(Modified, obj)
+			change.Fields = fields
+			changes = append(changes, change)
+		}
+	}
+	for _, obj := range old {
+		changes = append(changes, newChange(Removed, obj))
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Key < b.Key
+	})
+	return changes
+}
+
+// newChange describes obj.
+func newChange(changeType ChangeType, obj Object) Change {
+	group, version, found := strings.Cut(obj.Identity.APIVersion, "/")
+	if !found {
+		group, version = "", group
+	}
+	return Change{
+		Type:      changeType,
+		Group:     group,
+		Version:   version,
+		Kind:      obj.Identity.Kind,
+		Namespace: obj.Identity.Namespace,
+		Name:      obj.Identity.Name,
+		Key:       obj.Key,
+	}
+}
+
+// compareValues appends the differences between two values at path to fields, descending
+// into objects and lists so that only the innermost differing fields are reported.
+func compareValues(path string, before, after any, skip map[string]bool, fields *[]FieldChange) {
+	if skip[path] {
+		return
+	}
+
+	switch b := before.(type) {
+	case map[string]any:
+		a, ok := after.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(b)+len(a))
+		for key := range b {
+			keys = append(keys, key)
+		}
+		for key := range a {
+			if _, ok := b[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fieldPath := joinField(path, key)
+			beforeValue, inBefore := b[key]
+			afterValue, inAfter := a[key]
+			switch {
+			case skip[fieldPath]:
+			case !inBefore:
+				*fields = append(*fields, FieldChange{Path: fieldPath, Type: Added, After: afterValue})
+			case !inAfter:
+				*fields = append(*fields, FieldChange{Path: fieldPath, Type: Removed, Before: beforeValue})
+			default:
+				compareValues(fieldPath, beforeValue, afterValue, skip, fields)
+			}
+		}
+		return
+	case []any:
+		a, ok := after.([]any)
+		if !ok {
+			break
+		}
+		compareLists(path, b, a, skip, fields)
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*fields = append(*fields, FieldChange{Path: path, Type: Modified, Before: before, After: after})
+	}
+}
+
+// compareLists compares lists of named objects, such as containers or env variables, by
+// name so that an insertion does not show up as a change of every following item, and
+// other lists by index.
+func compareLists(path string, before, after []any, skip map[string]bool, fields *[]FieldChange) {
+	beforeNames, named := itemNames(before)
+	afterNames, afterNamed := itemNames(after)
+	if named && afterNamed {
+		for i, name := range beforeNames {
+			itemPath := fmt.Sprintf("%s[name=%s]", path, name)
+			if j := indexOf(afterNames, name); j >= 0 {
+				compareValues(itemPath, before[i], after[j], skip, fields)
+			} else {
+				*fields = append(*fields, FieldChange{Path: itemPath, Type: Removed, Before: before[i]})
+			}
+		}
+		for j, name := range afterNames {
+			if indexOf(beforeNames, name) < 0 {
+				*fields = append(*fields, FieldChange{Path: fmt.Sprintf("%s[name=%s]", path, name), Type: Added, After: after[j]})
+			}
+		}
+		return
+	}
+
+	for i := 0; i < len(before) || i < len(after); i++ {
+		itemPath := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i >= len(after):
+			*fields = append(*fields, FieldChange{Path: itemPath, Type: Removed, Before: before[i]})
+		case i >= len(before):
+			*fields = append(*fields, FieldChange{Path: itemPath, Type: Added, After: after[i]})
+		default:
+			compareValues(itemPath, before[i], after[i], skip, fields)
+		}
+	}
+}
+
+// itemNames returns the names of a list of objects, or false unless every item is an
+// object with a unique, non-empty name.
+func itemNames(items []any) ([]string, bool) {
+	names := make([]string, 0, len(items))
+	seen := map[string]bool{}
+	for _, item := range items {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		name, ok := object["name"].(string)
+		if !ok || name == "" || seen[name] {
+			return nil, false
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, true
+}
+
+// indexOf returns the index of name in names, or -1.
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// joinField appends a field to a path, quoting names that contain dots or brackets, like
+// the keys of labels and annotations.
+func joinField(path, field string) string {
+	if strings.ContainsAny(field, ".[]") {
+		return path + "[" + strconv.Quote(field) + "]"
+	}
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
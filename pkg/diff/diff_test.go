@@ -0,0 +1,175 @@
+package diff
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newObject(t *testing.T, key string, obj runtime.Object) Object {
+	t.Helper()
+	o, err := NewObject(key, obj)
+	if err != nil {
+		t.Fatalf("NewObject: %v", err)
+	}
+	return o
+}
+
+func deployment(replicas int32, image string, labels map[string]string, containers ...string) *appsv1.Deployment {
+	d := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", Labels: labels},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	for _, name := range containers {
+		d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, corev1.Container{Name: name, Image: image})
+	}
+	return d
+}
+
+func configMap(name string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "prod"},
+		Data:       data,
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before := []Object{
+		newObject(t, "/registry/deployments/prod/web", deployment(2, "web:1", map[string]string{"app.kubernetes.io/name": "web"}, "web", "proxy")),
+		newObject(t, "/registry/configmaps/prod/old", configMap("old", nil)),
+		newObject(t, "/registry/configmaps/prod/same", configMap("same", map[string]string{"a": "1"})),
+	}
+	after := []Object{
+		newObject(t, "/registry/configmaps/prod/same", configMap("same", map[string]string{"a": "1"})),
+		newObject(t, "/registry/configmaps/prod/new", configMap("new", nil)),
+		newObject(t, "/registry/deployments/prod/web", deployment(3, "web:2", map[string]string{"app.kubernetes.io/name": "web", "tier": "frontend"}, "init", "web", "proxy")),
+	}
+
+	changes := Compare(before, after, DefaultIgnoredFields)
+
+	var got []string
+	for _, change := range changes {
+		got = append(got, string(change.Type)+" "+change.String())
+	}
+	want := []string{"added core/ConfigMap prod/new", "removed core/ConfigMap prod/old", "modified apps/Deployment prod/web"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Compare() = %q, want %q", got, want)
+	}
+
+	modified := changes[2]
+	if modified.Group != "apps" || modified.Version != "v1" || modified.Key != "/registry/deployments/prod/web" {
+		t.Errorf("unexpected identity: %+v", modified)
+	}
+	var paths []string
+	for _, field := range modified.Fields {
+		paths = append(paths, field.Path)
+	}
+	wantPaths := []string{
+		`metadata.labels.tier`,
+		`spec.replicas`,
+		`spec.template.spec.containers[name=web].image`,
+		`spec.template.spec.containers[name=proxy].image`,
+		`spec.template.spec.containers[name=init]`,
+	}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("field paths = %q, want %q", paths, wantPaths)
+	}
+	replicas := modified.Fields[1]
+	if replicas.Before != float64(2) || replicas.After != float64(3) {
+		t.Errorf("spec.replicas changed from %v to %v, want 2 to 3", replicas.Before, replicas.After)
+	}
+	if label := modified.Fields[0]; label.Type != Added || label.Before != nil || label.After != "frontend" {
+		t.Errorf("expected an added label, got %+v", label)
+	}
+}
+
+func TestCompareIgnoredFields(t *testing.T) {
+	withManagedFields := func(manager string) *corev1.ConfigMap {
+		cm := configMap("cm", nil)
+		cm.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: manager}}
+		return cm
+	}
+	before := []Object{newObject(t, "/registry/configmaps/prod/cm", withManagedFields("kubectl"))}
+	after := []Object{newObject(t, "/registry/configmaps/prod/cm", withManagedFields("helm"))}
+
+	if changes := Compare(before, after, DefaultIgnoredFields); len(changes) != 0 {
+		t.Errorf("expected managed fields to be ignored, got %+v", changes)
+	}
+	if changes := Compare(before, after, nil); len(changes) != 1 || changes[0].Fields[0].Path != "metadata.managedFields[0].manager" {
+		t.Errorf("expected a managed fields change, got %+v", changes)
+	}
+}
+
+func TestCompareNull(t *testing.T) {
+	before := []Object{{Key: "/registry/configmaps/prod/cm", Content: map[string]any{"data": nil}}}
+	after := []Object{{Key: "/registry/configmaps/prod/cm", Content: map[string]any{"data": map[string]any{"a": "1"}}}}
+
+	changes := Compare(before, after, nil)
+	if len(changes) != 1 || len(changes[0].Fields) != 1 {
+		t.Fatalf("expected one changed field, got %+v", changes)
+	}
+	if field := changes[0].Fields[0]; field.Path != "data" || field.Type != Modified || field.Before != nil {
+		t.Errorf("expected data to change from null, got %+v", field)
+	}
+}
+
+func TestJoinField(t *testing.T) {
+	tests := map[string][2]string{
+		"spec":          {"", "spec"},
+		"spec.replicas": {"spec", "replicas"},
+		`metadata.labels["app.kubernetes.io/name"]`: {"metadata.labels", "app.kubernetes.io/name"},
+	}
+	for want, args := range tests {
+		if got := joinField(args[0], args[1]); got != want {
+			t.Errorf("joinField(%q, %q) = %q, want %q", args[0], args[1], got, want)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	changes := []Change{
+		{Type: Added, Kind: "ConfigMap", Namespace: "prod", Name: "new"},
+		{Type: Modified, Group: "apps", Kind: "Deployment", Namespace: "prod", Name: "web", Fields: []FieldChange{
+			{Path: "spec.replicas", Type: Modified, Before: float64(2), After: float64(3)},
+			{Path: "metadata.labels.tier", Type: Added, After: "frontend"},
+			{Path: "spec.template.spec.containers[name=init]", Type: Removed, Before: map[string]any{"name": "init", "image": "busybox"}},
+			{Path: "spec.paused", Type: Modified, Before: nil, After: true},
+		}},
+		{Type: Removed, Kind: "Namespace", Name: "staging"},
+	}
+
+	var out bytes.Buffer
+	if err := WriteText(&out, changes); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	want := strings.Join([]string{
+		"added     core/ConfigMap prod/new",
+		"modified  apps/Deployment prod/web",
+		"    spec.replicas:",
+		"    - 2",
+		"    + 3",
+		"    metadata.labels.tier:",
+		"    + frontend",
+		"    spec.template.spec.containers[name=init]:",
+		"    - image: busybox",
+		"    - name: init",
+		"    spec.paused:",
+		"    - null",
+		"    + true",
+		"removed   core/Namespace staging",
+		"",
+		"1 added, 1 removed, 1 modified",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant:\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,76 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// String names the object of a change as <group>/<kind> <namespace>/<name>, with "core"
+// for the core group and no namespace for cluster-scoped objects.
+func (c Change) String() string {
+	group := c.Group
+	if group == "" {
+		group = "core"
+	}
+	name := c.Name
+	if c.Namespace != "" {
+		name = c.Namespace + "/" + name
+	}
+	return fmt.Sprintf("%s/%s %s", group, c.Kind, name)
+}
+
+// Summary counts the changes of each type.
+func Summary(changes []Change) map[ChangeType]int {
+	counts := map[ChangeType]int{Added: 0, Removed: 0, Modified: 0}
+	for _, change := range changes {
+		counts[change.Type]++
+	}
+	return counts
+}
+
+// WriteText writes one line per change followed by the YAML of every differing field,
+// prefixed with "-" for the first snapshot and "+" for the second, and a summary. Fields
+// present in a snapshot are written even when null.
+func WriteText(w io.Writer, changes []Change) error {
+	for _, change := range changes {
+		if _, err := fmt.Fprintf(w, "%-9s %s\n", change.Type, change); err != nil {
+			return err
+		}
+		for _, field := range change.Fields {
+			if _, err := fmt.Fprintf(w, "    %s:\n", field.Path); err != nil {
+				return err
+			}
+			if field.Type != Added {
+				if err := writeValue(w, "-", field.Before); err != nil {
+					return err
+				}
+			}
+			if field.Type != Removed {
+				if err := writeValue(w, "+", field.After); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	counts := Summary(changes)
+	_, err := fmt.Fprintf(w, "\n%d added, %d removed, %d modified\n", counts[Added], counts[Removed], counts[Modified])
+	return err
+}
+
+// writeValue writes a value as YAML, each line prefixed with sign.
+func writeValue(w io.Writer, sign string, value any) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to render field value: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if _, err := fmt.Fprintf(w, "    %s %s\n", sign, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
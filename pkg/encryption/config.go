@@ -0,0 +1,173 @@
+// Package encryption reads, generates and imports the EncryptionConfiguration
+// kube-apiserver uses to encrypt resources at rest.
+package encryption
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion and Kind identify an EncryptionConfiguration file.
+	APIVersion = "apiserver.config.k8s.io/v1"
+	Kind       = "EncryptionConfiguration"
+
+	// legacyKind is accepted for configs written before the v1 API.
+	legacyKind = "EncryptionConfig"
+)
+
+// Config is an EncryptionConfiguration, as passed to --encryption-provider-config.
+type Config struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Resources  []ResourceConfig `json:"resources"`
+}
+
+// ResourceConfig lists the providers used for a set of resources, the first of
+// which encrypts new writes.
+type ResourceConfig struct {
+	Resources []string         `json:"resources"`
+	Providers []ProviderConfig `json:"providers"`
+}
+
+// ProviderConfig holds exactly one provider.
+type ProviderConfig struct {
+	AESGCM    *KeysConfig     `json:"aesgcm,omitempty"`
+	AESCBC    *KeysConfig     `json:"aescbc,omitempty"`
+	Secretbox *KeysConfig     `json:"secretbox,omitempty"`
+	Identity  *IdentityConfig `json:"identity,omitempty"`
+	KMS       *KMSConfig      `json:"kms,omitempty"`
+}
+
+// KeysConfig holds the keys of an aesgcm, aescbc or secretbox provider.
+type KeysConfig struct {
+	Keys []Key `json:"keys"`
+}
+
+// Key is a named, base64 encoded key.
+type Key struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+// IdentityConfig is the empty configuration of the identity provider.
+type IdentityConfig struct{}
+
+// KMSConfig identifies a KMS plugin; snapshot-insight cannot reach it.
+type KMSConfig struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Name       string `json:"name"`
+	Endpoint   string `json:"endpoint,omitempty"`
+}
+
+// Name returns the provider type, e.g. "aescbc".
+func (p ProviderConfig) Name() string {
+	switch {
+	case p.AESGCM != nil:
+		return "aesgcm"
+	case p.AESCBC != nil:
+		return "aescbc"
+	case p.Secretbox != nil:
+		return "secretbox"
+	case p.Identity != nil:
+		return "identity"
+	case p.KMS != nil:
+		return "kms"
+	default:
+		return ""
+	}
+}
+
+// Identity returns a configuration that stores secrets unencrypted. It lets
+// kube-apiserver start when the source cluster did not encrypt at rest.
+func Identity() *Config {
+	return &Config{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Resources: []ResourceConfig{{
+			Resources: []string{"secrets"},
+			Providers: []ProviderConfig{{Identity: &IdentityConfig{}}},
+		}},
+	}
+}
+
+// Load reads and validates an EncryptionConfiguration in JSON or YAML.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption configuration: %v", err)
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse encryption configuration %s: %v", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid encryption configuration %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks the kind and that every provider entry holds one provider.
+func (c *Config) Validate() error {
+	if c.Kind != Kind && c.Kind != legacyKind {
+		return fmt.Errorf("kind is %q, expected %s", c.Kind, Kind)
+	}
+	if len(c.Resources) == 0 {
+		return fmt.Errorf("no resources configured")
+	}
+
+	for i, resource := range c.Resources {
+		if len(resource.Resources) == 0 {
+			return fmt.Errorf("resources[%d] lists no resources", i)
+		}
+		if len(resource.Providers) == 0 {
+			return fmt.Errorf("resources[%d] has no providers", i)
+		}
+		for j, provider := range resource.Providers {
+			count := 0
+			for _, set := range []bool{provider.AESGCM != nil, provider.AESCBC != nil, provider.Secretbox != nil, provider.Identity != nil, provider.KMS != nil} {
+				if set {
+					count++
+				}
+			}
+			if count != 1 {
+				return fmt.Errorf("resources[%d].providers[%d] must configure exactly one provider", i, j)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckUsable reports an error when the configuration depends on a KMS plugin,
+// which kube-apiserver cannot reach outside the source cluster.
+func (c *Config) CheckUsable() error {
+	for _, resource := range c.Resources {
+		for _, provider := range resource.Providers {
+			if provider.KMS != nil {
+				return fmt.Errorf("KMS provider %s for %s cannot be used outside the source cluster", provider.KMS.Name, strings.Join(resource.Resources, ","))
+			}
+		}
+	}
+	return nil
+}
+
+// Write stores the configuration as JSON, readable only by the owner.
+func (c *Config) Write(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode encryption configuration: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write encryption configuration: %v", err)
+	}
+	return nil
+}
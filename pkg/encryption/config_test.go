@@ -0,0 +1,83 @@
+package encryption
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "json", content: aescbcConfig},
+		{
+			name: "yaml with legacy kind",
+			content: `kind: EncryptionConfig
+apiVersion: v1
+resources:
+- resources: [secrets, configmaps]
+  providers:
+  - secretbox:
+      keys:
+      - name: key1
+        secret: YWJjZGVmZ2hpamtsbW5vcHFyc3R1dnd4eXoxMjM0NTY=
+  - identity: {}
+`,
+		},
+		{name: "wrong kind", content: "kind: Pod\n", wantErr: `kind is "Pod"`},
+		{name: "no resources", content: "kind: EncryptionConfiguration\n", wantErr: "no resources configured"},
+		{
+			name:    "two providers in one entry",
+			content: "kind: EncryptionConfiguration\nresources:\n- resources: [secrets]\n  providers:\n  - identity: {}\n    aescbc: {keys: []}\n",
+			wantErr: "must configure exactly one provider",
+		},
+		{name: "not yaml", content: "{{", wantErr: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load(path)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Load: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIdentityRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "encryption-config.json")
+	if err := Identity().Write(path); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(config.Resources) != 1 || config.Resources[0].Providers[0].Name() != "identity" {
+		t.Errorf("unexpected identity configuration: %+v", config)
+	}
+	if err := config.CheckUsable(); err != nil {
+		t.Errorf("CheckUsable: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,269 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// encryptedPrefix marks values written through an encrypting provider; it is
+// followed by "<provider>:v1:<key name>:" and the ciphertext.
+const encryptedPrefix = "k8s:enc:"
+
+const (
+	secretboxKeySize   = 32
+	secretboxNonceSize = 24
+)
+
+// ErrNoKey is returned when no configured key matches an encrypted value.
+var ErrNoKey = errors.New("no matching key in encryption configuration")
+
+// Envelope describes how a stored value was encrypted.
+type Envelope struct {
+	// Provider is aescbc, aesgcm, secretbox, kms or kms:v2.
+	Provider string
+	// Key is the name of the key, or of the KMS plugin.
+	Key string
+}
+
+// String renders the envelope as provider:key.
+func (e Envelope) String() string {
+	return e.Provider + ":" + e.Key
+}
+
+// Describe reports the provider and key name of an encrypted value, or false
+// when the value is stored in plain text.
+func Describe(value []byte) (Envelope, bool) {
+	rest, ok := bytes.CutPrefix(value, []byte(encryptedPrefix))
+	if !ok {
+		return Envelope{}, false
+	}
+
+	// <provider>:v1:<key>:<ciphertext>; KMS v2 values are "kms:v2:<plugin>:"
+	parts := strings.SplitN(string(rest[:min(len(rest), 256)]), ":", 4)
+	if len(parts) < 3 {
+		return Envelope{Provider: "unknown"}, true
+	}
+	if parts[0] == "kms" && parts[1] == "v2" {
+		return Envelope{Provider: "kms:v2", Key: parts[2]}, true
+	}
+	return Envelope{Provider: parts[0], Key: parts[2]}, true
+}
+
+// decryptFunc decrypts the ciphertext following a transformer prefix.
+type decryptFunc func(ciphertext, authenticatedData []byte) ([]byte, error)
+
+// transformer decrypts values written with a single key.
+type transformer struct {
+	prefix  []byte
+	decrypt decryptFunc
+}
+
+// resourceTransformers are the transformers of one resources entry.
+type resourceTransformers struct {
+	resources    []string
+	transformers []transformer
+}
+
+// Decryptor decrypts etcd values offline with the keys of an EncryptionConfiguration.
+type Decryptor struct {
+	resources []resourceTransformers
+}
+
+// NewDecryptor prepares the aescbc, aesgcm and secretbox keys of a configuration.
+// KMS providers are kept out, their keys never leave the plugin.
+func NewDecryptor(config *Config) (*Decryptor, error) {
+	d := &Decryptor{}
+	for i, resource := range config.Resources {
+		rt := resourceTransformers{resources: resource.Resources}
+		for j, provider := range resource.Providers {
+			var (
+				keys       []Key
+				newDecrypt func(secret []byte) (decryptFunc, error)
+			)
+			switch {
+			case provider.AESCBC != nil:
+				keys, newDecrypt = provider.AESCBC.Keys, newCBC
+			case provider.AESGCM != nil:
+				keys, newDecrypt = provider.AESGCM.Keys, newGCM
+			case provider.Secretbox != nil:
+				keys, newDecrypt = provider.Secretbox.Keys, newSecretbox
+			default:
+				continue
+			}
+
+			for _, key := range keys {
+				secret, err := base64.StdEncoding.DecodeString(key.Secret)
+				if err != nil {
+					return nil, fmt.Errorf("resources[%d].providers[%d]: key %s is not valid base64: %v", i, j, key.Name, err)
+				}
+				decrypt, err := newDecrypt(secret)
+				if err != nil {
+					return nil, fmt.Errorf("resources[%d].providers[%d]: key %s: %v", i, j, key.Name, err)
+				}
+				rt.transformers = append(rt.transformers, transformer{
+					prefix:  []byte(fmt.Sprintf("%s%s:v1:%s:", encryptedPrefix, provider.Name(), key.Name)),
+					decrypt: decrypt,
+				})
+			}
+		}
+		d.resources = append(d.resources, rt)
+	}
+	return d, nil
+}
+
+// Decrypt returns the plain text of a value stored under an etcd key. Values
+// that are not encrypted are returned unchanged.
+func (d *Decryptor) Decrypt(key string, value []byte) ([]byte, error) {
+	envelope, encrypted := Describe(value)
+	if !encrypted {
+		return value, nil
+	}
+	if strings.HasPrefix(envelope.Provider, "kms") {
+		return nil, fmt.Errorf("%s is encrypted with KMS plugin %s, which cannot be used offline", key, envelope.Key)
+	}
+
+	var lastErr error
+	for _, rt := range d.candidates(key) {
+		for _, t := range rt.transformers {
+			ciphertext, ok := bytes.CutPrefix(value, t.prefix)
+			if !ok {
+				continue
+			}
+			plain, err := t.decrypt(ciphertext, []byte(key))
+			if err == nil {
+				return plain, nil
+			}
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to decrypt %s with %s: %v", key, envelope, lastErr)
+	}
+	return nil, fmt.Errorf("%s is encrypted with %s: %w", key, envelope, ErrNoKey)
+}
+
+// candidates returns the resources entries configured for an etcd key first,
+// followed by the others, so that a key listed under the wrong resource still works.
+func (d *Decryptor) candidates(key string) []resourceTransformers {
+	var matching, others []resourceTransformers
+	for _, rt := range d.resources {
+		if matchesAny(rt.resources, key) {
+			matching = append(matching, rt)
+		} else {
+			others = append(others, rt)
+		}
+	}
+	return append(matching, others...)
+}
+
+// matchesAny reports whether an etcd key belongs to one of the configured
+// resources, which are "resource" for the core group, "resource.group", "*.group",
+// "*." for all core resources or "*.*" for everything.
+func matchesAny(resources []string, key string) bool {
+	path := strings.TrimPrefix(key, "/registry/")
+	first, rest, _ := strings.Cut(path, "/")
+	second, _, _ := strings.Cut(rest, "/")
+
+	for _, resource := range resources {
+		name, group, _ := strings.Cut(resource, ".")
+		switch {
+		case resource == "*.*":
+			return true
+		case group == "":
+			// Core resources live directly under /registry/<resource>/
+			if name == first || (name == "*" && !strings.Contains(first, ".")) {
+				return true
+			}
+		case name == "*":
+			if first == group {
+				return true
+			}
+		default:
+			// Other groups live under /registry/<group>/<resource>/, built-in
+			// groups such as apps under /registry/<resource>/
+			if (first == group && second == name) || first == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newCBC returns an aescbc decrypter: a 16 byte IV followed by PKCS#7 padded blocks.
+func newCBC(secret []byte) (decryptFunc, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(data, _ []byte) ([]byte, error) {
+		if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("ciphertext has invalid length %d", len(data))
+		}
+		iv, data := data[:aes.BlockSize], data[aes.BlockSize:]
+
+		plain := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+		padding := int(plain[len(plain)-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return nil, errors.New("invalid padding, wrong key?")
+		}
+		for _, b := range plain[len(plain)-padding:] {
+			if int(b) != padding {
+				return nil, errors.New("invalid padding, wrong key?")
+			}
+		}
+		return plain[:len(plain)-padding], nil
+	}, nil
+}
+
+// newGCM returns an aesgcm decrypter: a 12 byte nonce followed by the sealed
+// data, authenticated with the etcd key.
+func newGCM(secret []byte) (decryptFunc, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(data, authenticatedData []byte) ([]byte, error) {
+		if len(data) < aead.NonceSize() {
+			return nil, fmt.Errorf("ciphertext has invalid length %d", len(data))
+		}
+		return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], authenticatedData)
+	}, nil
+}
+
+// newSecretbox returns a secretbox decrypter: a 24 byte nonce followed by the sealed data.
+func newSecretbox(secret []byte) (decryptFunc, error) {
+	if len(secret) != secretboxKeySize {
+		return nil, fmt.Errorf("secretbox keys must be %d bytes, got %d", secretboxKeySize, len(secret))
+	}
+	var key [secretboxKeySize]byte
+	copy(key[:], secret)
+
+	return func(data, _ []byte) ([]byte, error) {
+		if len(data) < secretboxNonceSize {
+			return nil, fmt.Errorf("ciphertext has invalid length %d", len(data))
+		}
+		var nonce [secretboxNonceSize]byte
+		copy(nonce[:], data[:secretboxNonceSize])
+
+		plain, ok := secretbox.Open(nil, data[secretboxNonceSize:], &nonce, &key)
+		if !ok {
+			return nil, errors.New("message authentication failed, wrong key?")
+		}
+		return plain, nil
+	}, nil
+}
@@ -0,0 +1,196 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const secretKey = "/registry/secrets/default/db-password"
+
+func TestDecrypt(t *testing.T) {
+	cbcKey := randomKey(t, 32)
+	gcmKey := randomKey(t, 16)
+	boxKey := randomKey(t, 32)
+	oldKey := randomKey(t, 32)
+	plain := []byte("k8s\x00protobuf secret payload")
+
+	config := &Config{
+		Kind: Kind,
+		Resources: []ResourceConfig{
+			{
+				Resources: []string{"secrets"},
+				Providers: []ProviderConfig{
+					{AESCBC: &KeysConfig{Keys: []Key{{Name: "new", Secret: encodeKey(cbcKey)}, {Name: "old", Secret: encodeKey(oldKey)}}}},
+					{AESGCM: &KeysConfig{Keys: []Key{{Name: "gcm", Secret: encodeKey(gcmKey)}}}},
+					{Identity: &IdentityConfig{}},
+				},
+			},
+			{
+				Resources: []string{"configmaps", "*.cert-manager.io"},
+				Providers: []ProviderConfig{{Secretbox: &KeysConfig{Keys: []Key{{Name: "box", Secret: encodeKey(boxKey)}}}}},
+			},
+		},
+	}
+	d, err := NewDecryptor(config)
+	if err != nil {
+		t.Fatalf("NewDecryptor: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		value   []byte
+		want    []byte
+		wantErr string
+	}{
+		{name: "plain value", key: secretKey, value: plain, want: plain},
+		{name: "aescbc", key: secretKey, value: encryptCBC(t, "new", cbcKey, plain), want: plain},
+		{name: "aescbc with a rotated key", key: secretKey, value: encryptCBC(t, "old", oldKey, plain), want: plain},
+		{name: "aesgcm", key: secretKey, value: encryptGCM(t, "gcm", gcmKey, secretKey, plain), want: plain},
+		{
+			name:    "aesgcm bound to another key",
+			key:     secretKey,
+			value:   encryptGCM(t, "gcm", gcmKey, "/registry/secrets/default/other", plain),
+			wantErr: "failed to decrypt " + secretKey + " with aesgcm:gcm",
+		},
+		{name: "secretbox", key: "/registry/configmaps/default/settings", value: encryptSecretbox(t, "box", boxKey, plain), want: plain},
+		{name: "secretbox for a custom resource", key: "/registry/cert-manager.io/certificates/default/tls", value: encryptSecretbox(t, "box", boxKey, plain), want: plain},
+		{name: "wrong key material", key: secretKey, value: encryptGCM(t, "gcm", randomKey(t, 16), secretKey, plain), wantErr: "message authentication failed"},
+		{name: "unknown key name", key: secretKey, value: encryptCBC(t, "retired", cbcKey, plain), wantErr: ErrNoKey.Error()},
+		{name: "kms", key: secretKey, value: []byte("k8s:enc:kms:v2:vault:payload"), wantErr: "KMS plugin vault"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Decrypt(tt.key, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decrypt() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Decrypt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := d.Decrypt(secretKey, encryptCBC(t, "retired", cbcKey, plain)); !errors.Is(err, ErrNoKey) {
+		t.Errorf("expected ErrNoKey, got %v", err)
+	}
+}
+
+func TestNewDecryptorInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		wantErr  string
+	}{
+		{name: "not base64", provider: ProviderConfig{AESCBC: &KeysConfig{Keys: []Key{{Name: "k", Secret: "%%%"}}}}, wantErr: "not valid base64"},
+		{name: "bad aes length", provider: ProviderConfig{AESGCM: &KeysConfig{Keys: []Key{{Name: "k", Secret: encodeKey(make([]byte, 10))}}}}, wantErr: "invalid key size"},
+		{name: "bad secretbox length", provider: ProviderConfig{Secretbox: &KeysConfig{Keys: []Key{{Name: "k", Secret: encodeKey(make([]byte, 16))}}}}, wantErr: "secretbox keys must be 32 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Kind: Kind, Resources: []ResourceConfig{{Resources: []string{"secrets"}, Providers: []ProviderConfig{tt.provider}}}}
+			if _, err := NewDecryptor(config); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewDecryptor() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      string
+		encrypted bool
+	}{
+		{value: "k8s:enc:aescbc:v1:key1:\x00\x01", want: "aescbc:key1", encrypted: true},
+		{value: "k8s:enc:kms:v2:vault:\x00", want: "kms:v2:vault", encrypted: true},
+		{value: "k8s\x00protobuf"},
+	}
+
+	for _, tt := range tests {
+		envelope, encrypted := Describe([]byte(tt.value))
+		if encrypted != tt.encrypted || (encrypted && envelope.String() != tt.want) {
+			t.Errorf("Describe(%q) = %s, %v, want %s, %v", tt.value, envelope, encrypted, tt.want, tt.encrypted)
+		}
+	}
+}
+
+// The helpers below encrypt values the way kube-apiserver's transformers do.
+
+func encryptCBC(t *testing.T, name string, key, plain []byte) []byte {
+	t.Helper()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	out := make([]byte, aes.BlockSize+len(padded))
+	if _, err := rand.Read(out[:aes.BlockSize]); err != nil {
+		t.Fatal(err)
+	}
+	cipher.NewCBCEncrypter(block, out[:aes.BlockSize]).CryptBlocks(out[aes.BlockSize:], padded)
+	return append([]byte("k8s:enc:aescbc:v1:"+name+":"), out...)
+}
+
+func encryptGCM(t *testing.T, name string, key []byte, etcdKey string, plain []byte) []byte {
+	t.Helper()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte("k8s:enc:aesgcm:v1:"+name+":"), aead.Seal(nonce, nonce, plain, []byte(etcdKey))...)
+}
+
+func encryptSecretbox(t *testing.T, name string, key, plain []byte) []byte {
+	t.Helper()
+
+	var k [32]byte
+	var nonce [24]byte
+	copy(k[:], key)
+	if _, err := rand.Read(nonce[:]); err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte("k8s:enc:secretbox:v1:"+name+":"), secretbox.Seal(nonce[:], plain, &nonce, &k)...)
+}
+
+func randomKey(t *testing.T, size int) []byte {
+	t.Helper()
+
+	key := make([]byte, size)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func encodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
@@ -0,0 +1,116 @@
+package encryption
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/supporttools/snapshot-insight/pkg/backup"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Known locations relative to a node's filesystem root.
+var (
+	// distributionConfigs are written by RKE2 and k3s servers.
+	distributionConfigs = []string{
+		"var/lib/rancher/rke2/server/cred/encryption-config.json",
+		"var/lib/rancher/k3s/server/cred/encryption-config.json",
+	}
+	// apiServerManifests are static pod manifests naming --encryption-provider-config.
+	apiServerManifests = []string{
+		"etc/kubernetes/manifests/kube-apiserver.yaml",
+		"var/lib/rancher/rke2/agent/pod-manifests/kube-apiserver.yaml",
+	}
+)
+
+const providerConfigFlag = "--encryption-provider-config"
+
+// FindInBackup locates the encryption configuration in a backup of a control
+// plane node. root may be the node's filesystem root or any directory below it,
+// such as a copy of /var/lib/rancher/rke2 or /etc/kubernetes.
+func FindInBackup(root string) (string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %v", err)
+	}
+	if !info.IsDir() {
+		// A single file is taken as the configuration itself
+		return root, nil
+	}
+
+	for _, rel := range distributionConfigs {
+		if path, ok := backup.Find(root, rel); ok {
+			return path, nil
+		}
+	}
+
+	for _, rel := range apiServerManifests {
+		manifest, ok := backup.Find(root, rel)
+		if !ok {
+			continue
+		}
+		configPath, err := providerConfigFromManifest(manifest)
+		if err != nil {
+			return "", err
+		}
+		if configPath == "" {
+			return "", fmt.Errorf("%s does not set %s; the cluster did not encrypt at rest", manifest, providerConfigFlag)
+		}
+		if path, ok := backup.Find(root, strings.TrimPrefix(configPath, "/")); ok {
+			return path, nil
+		}
+		return "", fmt.Errorf("%s references %s, which is not part of the backup", manifest, configPath)
+	}
+
+	return "", fmt.Errorf("no encryption configuration or kube-apiserver manifest found in %s", root)
+}
+
+// Import loads the encryption configuration from a node backup and writes it
+// to dst, returning the loaded configuration. Nothing is written when the
+// configuration is not usable outside the source cluster, see CheckUsable.
+func Import(backup, dst string) (*Config, error) {
+	path, err := FindInBackup(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.CheckUsable(); err != nil {
+		return nil, err
+	}
+	if err := config.Write(dst); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// providerConfigFromManifest returns the --encryption-provider-config value of
+// the kube-apiserver container in a static pod manifest.
+func providerConfigFromManifest(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	pod := &corev1.Pod{}
+	if err := yaml.Unmarshal(data, pod); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	for _, c := range pod.Spec.Containers {
+		args := append(append([]string{}, c.Command...), c.Args...)
+		for i, arg := range args {
+			if value, ok := strings.CutPrefix(arg, providerConfigFlag+"="); ok {
+				return value, nil
+			}
+			if arg == providerConfigFlag && i+1 < len(args) {
+				return args[i+1], nil
+			}
+		}
+	}
+	return "", nil
+}
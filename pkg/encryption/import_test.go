@@ -0,0 +1,158 @@
+package encryption
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const aescbcConfig = `{
+  "kind": "EncryptionConfiguration",
+  "apiVersion": "apiserver.config.k8s.io/v1",
+  "resources": [
+    {
+      "resources": ["secrets"],
+      "providers": [
+        {"aescbc": {"keys": [{"name": "aescbckey", "secret": "c2VjcmV0IGlzIHNlY3VyZSwgb3IgaXMgaXQ/Cg=="}]}},
+        {"identity": {}}
+      ]
+    }
+  ]
+}`
+
+const kubeadmManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-apiserver
+  namespace: kube-system
+spec:
+  containers:
+  - name: kube-apiserver
+    image: registry.k8s.io/kube-apiserver:v1.28.2
+    command:
+    - kube-apiserver
+    - --advertise-address=10.0.0.10
+    - --encryption-provider-config=/etc/kubernetes/enc/enc.yaml
+`
+
+func TestFindInBackup(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		root    string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "rke2 node root",
+			files: map[string]string{"var/lib/rancher/rke2/server/cred/encryption-config.json": aescbcConfig},
+			want:  "var/lib/rancher/rke2/server/cred/encryption-config.json",
+		},
+		{
+			name:  "copy of the k3s data directory",
+			files: map[string]string{"k3s/server/cred/encryption-config.json": aescbcConfig},
+			root:  "k3s",
+			want:  "k3s/server/cred/encryption-config.json",
+		},
+		{
+			name: "kubeadm manifest in a copy of /etc/kubernetes",
+			files: map[string]string{
+				"kubernetes/manifests/kube-apiserver.yaml": kubeadmManifest,
+				"kubernetes/enc/enc.yaml":                  aescbcConfig,
+			},
+			root: "kubernetes",
+			want: "kubernetes/enc/enc.yaml",
+		},
+		{
+			name:    "kubeadm manifest referencing a file outside the backup",
+			files:   map[string]string{"etc/kubernetes/manifests/kube-apiserver.yaml": kubeadmManifest},
+			wantErr: "references /etc/kubernetes/enc/enc.yaml, which is not part of the backup",
+		},
+		{
+			name:    "kubeadm cluster without encryption at rest",
+			files:   map[string]string{"etc/kubernetes/manifests/kube-apiserver.yaml": strings.Replace(kubeadmManifest, "    - --encryption-provider-config=/etc/kubernetes/enc/enc.yaml\n", "", 1)},
+			wantErr: "did not encrypt at rest",
+		},
+		{
+			name:    "unrelated directory",
+			files:   map[string]string{"notes.txt": "hello"},
+			wantErr: "no encryption configuration or kube-apiserver manifest found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := FindInBackup(filepath.Join(dir, tt.root))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("FindInBackup() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindInBackup: %v", err)
+			}
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("FindInBackup() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	backup := filepath.Join(t.TempDir(), "var/lib/rancher/rke2/server/cred/encryption-config.json")
+	if err := os.MkdirAll(filepath.Dir(backup), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(backup, []byte(aescbcConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "out", "encryption-config.json")
+
+	config, err := Import(filepath.Dir(backup), dst)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if name := config.Resources[0].Providers[0].Name(); name != "aescbc" {
+		t.Errorf("first provider = %s, want aescbc", name)
+	}
+
+	written, err := Load(dst)
+	if err != nil {
+		t.Fatalf("Load(imported): %v", err)
+	}
+	if key := written.Resources[0].Providers[0].AESCBC.Keys[0]; key.Name != "aescbckey" {
+		t.Errorf("imported key = %+v, want aescbckey", key)
+	}
+}
+
+func TestImportKMS(t *testing.T) {
+	backup := filepath.Join(t.TempDir(), "var/lib/rancher/k3s/server/cred/encryption-config.json")
+	if err := os.MkdirAll(filepath.Dir(backup), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	kmsConfig := "kind: EncryptionConfiguration\nresources:\n- resources: [secrets]\n  providers:\n  - kms: {name: vault, endpoint: unix:///run/kms.sock}\n"
+	if err := os.WriteFile(backup, []byte(kmsConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "encryption-config.json")
+
+	if _, err := Import(filepath.Dir(backup), dst); err == nil || !strings.Contains(err.Error(), "KMS provider vault") {
+		t.Fatalf("Import() error = %v, want a KMS error", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected no configuration to be written, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiServicesPath is the APIService collection of kube-apiserver.
+const apiServicesPath = "/apis/apiregistration.k8s.io/v1/apiservices"
+
+// localAPIServicePatch removes the service of an APIService, which makes it local-only:
+// kube-apiserver serves the group itself instead of proxying to an extension API server.
+const localAPIServicePatch = `{"spec":{"service":null,"caBundle":null,"insecureSkipTLSVerify":false}}`
+
+// apiServiceList is the part of an APIServiceList needed to find remote APIServices.
+type apiServiceList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			Service *struct {
+				Namespace string `json:"namespace"`
+				Name      string `json:"name"`
+			} `json:"service"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// localizeAPIServices makes every APIService backed by a service local-only. No pods run
+// next to the restored data, so the extension API servers they point at are unreachable and
+// requests for their groups, including discovery, would otherwise fail or time out. It
+// returns the names of the changed APIServices.
+func localizeAPIServices(ctx context.Context, serverURL string, tlsConfig *tls.Config) ([]string, error) {
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	url := strings.TrimSuffix(serverURL, "/") + apiServicesPath
+
+	list := apiServiceList{}
+	if err := apiRequest(ctx, client, http.MethodGet, url, nil, &list); err != nil {
+		return nil, fmt.Errorf("failed to list APIServices: %v", err)
+	}
+
+	var changed []string
+	for _, item := range list.Items {
+		if item.Spec.Service == nil {
+			continue
+		}
+		name := item.Metadata.Name
+		if err := apiRequest(ctx, client, http.MethodPatch, url+"/"+name, []byte(localAPIServicePatch), nil); err != nil {
+			return changed, fmt.Errorf("failed to make APIService %s local-only: %v", name, err)
+		}
+		fmt.Printf("APIService %s was served by %s/%s and is now local-only.\n", name, item.Spec.Service.Namespace, item.Spec.Service.Name)
+		changed = append(changed, name)
+	}
+	return changed, nil
+}
+
+// apiRequest sends a JSON merge patch, or a request without body, to kube-apiserver and
+// decodes the response into out when it is not nil.
+func apiRequest(ctx context.Context, client *http.Client, method, url string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, url, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", url, err)
+	}
+	return nil
+}
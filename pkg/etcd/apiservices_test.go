@@ -0,0 +1,107 @@
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+func TestLocalizeAPIServices(t *testing.T) {
+	var patches []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == apiServicesPath:
+			_, _ = io.WriteString(w, `{"items": [
+				{"metadata": {"name": "v1.apps"}, "spec": {"group": "apps", "version": "v1"}},
+				{"metadata": {"name": "v1beta1.metrics.k8s.io"}, "spec": {"service": {"namespace": "kube-system", "name": "metrics-server"}}},
+				{"metadata": {"name": "v1beta1.custom.metrics.k8s.io"}, "spec": {"service": {"namespace": "monitoring", "name": "prometheus-adapter"}}}
+			]}`)
+		case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, apiServicesPath+"/"):
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get("Content-Type") != "application/merge-patch+json" || string(body) != localAPIServicePatch {
+				http.Error(w, "unexpected patch", http.StatusBadRequest)
+				return
+			}
+			patches = append(patches, strings.TrimPrefix(r.URL.Path, apiServicesPath+"/"))
+			_, _ = io.WriteString(w, "{}")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	changed, err := localizeAPIServices(context.Background(), srv.URL, srv.Client().Transport.(*http.Transport).TLSClientConfig)
+	if err != nil {
+		t.Fatalf("localizeAPIServices: %v", err)
+	}
+	want := []string{"v1beta1.metrics.k8s.io", "v1beta1.custom.metrics.k8s.io"}
+	if !reflect.DeepEqual(changed, want) || !reflect.DeepEqual(patches, want) {
+		t.Errorf("changed %v and patched %v, want %v", changed, patches, want)
+	}
+}
+
+func TestLocalizeAPIServicesErrors(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := localizeAPIServices(context.Background(), srv.URL, srv.Client().Transport.(*http.Transport).TLSClientConfig)
+	checkErr(t, err, "failed to list APIServices: GET "+srv.URL+apiServicesPath+" returned 403 Forbidden: forbidden")
+
+	// The certificate of the test server is not signed by the session CA
+	_, err = localizeAPIServices(context.Background(), srv.URL, &tls.Config{})
+	checkErr(t, err, "certificate")
+}
+
+func TestStartKubeAPIServerDisableAdmissionWebhooks(t *testing.T) {
+	rt := container.NewFake()
+
+	if err := StartKubeAPIServer(context.Background(), rt, "http://127.0.0.1:2379", "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{DisableAdmissionWebhooks: true, OutputDir: t.TempDir(), Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages}); err != nil {
+		t.Fatalf("StartKubeAPIServer: %v", err)
+	}
+	args := strings.Join(rt.CallsFor("run")[0].Args, " ")
+	if !strings.Contains(args, "--disable-admission-plugins=MutatingAdmissionWebhook,ValidatingAdmissionWebhook") {
+		t.Errorf("expected admission webhooks to be disabled: %s", args)
+	}
+}
+
+func TestStartKubeAPIServerLocalAPIServicesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    KubeAPIServerOptions
+		wantErr string
+	}{
+		{
+			name:    "no readiness wait",
+			opts:    KubeAPIServerOptions{LocalAPIServices: true},
+			wantErr: "local-only APIServices need kube-apiserver to become ready",
+		},
+		{
+			name:    "read-only",
+			opts:    KubeAPIServerOptions{LocalAPIServices: true, ReadOnly: true, ReadyTimeout: time.Minute},
+			wantErr: "local-only APIServices change the restored data, which read-only mode protects",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := container.NewFake()
+			tt.opts.OutputDir, tt.opts.Network, tt.opts.Ports, tt.opts.Images = t.TempDir(), DefaultNetwork(), DefaultPorts(), testImages
+
+			err := StartKubeAPIServer(context.Background(), rt, "http://127.0.0.1:2379", "apiserver", "certs", "192.0.2.10", tt.opts)
+			checkErr(t, err, tt.wantErr)
+			if runs := rt.CallsFor("run"); len(runs) != 0 {
+				t.Errorf("expected kube-apiserver not to be started, got %d runs", len(runs))
+			}
+		})
+	}
+}
@@ -1,17 +1,18 @@
 package etcd
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
 )
 
-// CleanupEtcd removes the etcd Docker container and any temporary resources created during the restore process.
-func CleanupEtcd(containerName string) error {
+// CleanupEtcd removes the etcd container and any temporary resources created during the restore process.
+func CleanupEtcd(ctx context.Context, rt container.Runtime, containerName string) error {
 	fmt.Printf("Stopping and removing etcd container: %s...\n", containerName)
 
-	// Stop and remove the Docker container
-	cmd := exec.Command("docker", "rm", "-f", containerName)
-	if err := cmd.Run(); err != nil {
+	// Stop and remove the container
+	if err := rt.Remove(ctx, containerName); err != nil {
 		return fmt.Errorf("failed to clean up etcd container %s: %v", containerName, err)
 	}
 
@@ -19,13 +20,12 @@ func CleanupEtcd(containerName string) error {
 	return nil
 }
 
-// CleanupKubeAPIServer removes the kube-apiserver Docker container.
-func CleanupKubeAPIServer(containerName string) error {
+// CleanupKubeAPIServer removes the kube-apiserver container.
+func CleanupKubeAPIServer(ctx context.Context, rt container.Runtime, containerName string) error {
 	fmt.Printf("Stopping and removing kube-apiserver container: %s...\n", containerName)
 
-	// Stop and remove the Docker container
-	cmd := exec.Command("docker", "rm", "-f", containerName)
-	if err := cmd.Run(); err != nil {
+	// Stop and remove the container
+	if err := rt.Remove(ctx, containerName); err != nil {
 		return fmt.Errorf("failed to clean up kube-apiserver container %s: %v", containerName, err)
 	}
 
@@ -33,15 +33,30 @@ func CleanupKubeAPIServer(containerName string) error {
 	return nil
 }
 
-// CleanupVolume removes a specified Docker volume.
-func CleanupVolume(volumeName string) error {
-	fmt.Printf("Removing Docker volume: %s...\n", volumeName)
+// CleanupVolume removes a specified volume.
+func CleanupVolume(ctx context.Context, rt container.Runtime, volumeName string) error {
+	fmt.Printf("Removing volume: %s...\n", volumeName)
+
+	if err := rt.VolumeRemove(ctx, volumeName); err != nil {
+		return fmt.Errorf("failed to clean up volume %s: %v", volumeName, err)
+	}
+
+	fmt.Println("Volume cleaned up successfully.")
+	return nil
+}
+
+// CleanupNetwork removes the dedicated network of bridge mode. It is not an error if the
+// network does not exist, as sessions running in host mode never create one.
+func CleanupNetwork(ctx context.Context, rt container.Runtime, networkName string) error {
+	if !rt.NetworkExists(ctx, networkName) {
+		return nil
+	}
+	fmt.Printf("Removing network: %s...\n", networkName)
 
-	cmd := exec.Command("docker", "volume", "rm", volumeName)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to clean up Docker volume %s: %v", volumeName, err)
+	if err := rt.NetworkRemove(ctx, networkName); err != nil {
+		return fmt.Errorf("failed to clean up network %s: %v", networkName, err)
 	}
 
-	fmt.Println("Docker volume cleaned up successfully.")
+	fmt.Println("Network cleaned up successfully.")
 	return nil
 }
@@ -0,0 +1,85 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+func TestCleanup(t *testing.T) {
+	tests := []struct {
+		name    string
+		cleanup func(container.Runtime) error
+		errors  map[string]error
+		wantOp  string
+		wantErr string
+	}{
+		{
+			name:    "etcd",
+			cleanup: func(rt container.Runtime) error { return CleanupEtcd(context.Background(), rt, "etcd") },
+			wantOp:  "rm etcd",
+		},
+		{
+			name:    "etcd failure",
+			cleanup: func(rt container.Runtime) error { return CleanupEtcd(context.Background(), rt, "etcd") },
+			errors:  map[string]error{"rm": errors.New("daemon not running")},
+			wantOp:  "rm etcd",
+			wantErr: "failed to clean up etcd container etcd: daemon not running",
+		},
+		{
+			name:    "kube-apiserver",
+			cleanup: func(rt container.Runtime) error { return CleanupKubeAPIServer(context.Background(), rt, "apiserver") },
+			wantOp:  "rm apiserver",
+		},
+		{
+			name:    "kube-apiserver failure",
+			cleanup: func(rt container.Runtime) error { return CleanupKubeAPIServer(context.Background(), rt, "apiserver") },
+			errors:  map[string]error{"rm": errors.New("daemon not running")},
+			wantOp:  "rm apiserver",
+			wantErr: "failed to clean up kube-apiserver container apiserver",
+		},
+		{
+			name:    "volume",
+			cleanup: func(rt container.Runtime) error { return CleanupVolume(context.Background(), rt, "data") },
+			wantOp:  "volume-rm data",
+		},
+		{
+			name:    "volume in use",
+			cleanup: func(rt container.Runtime) error { return CleanupVolume(context.Background(), rt, "data") },
+			errors:  map[string]error{"volume-rm": errors.New("volume is in use")},
+			wantOp:  "volume-rm data",
+			wantErr: "failed to clean up volume data: volume is in use",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := container.NewFake()
+			rt.Errors = tt.errors
+
+			checkErr(t, tt.cleanup(rt), tt.wantErr)
+			if want := []string{tt.wantOp}; !reflect.DeepEqual(rt.Ops(), want) {
+				t.Errorf("ops mismatch\ngot:  %q\nwant: %q", rt.Ops(), want)
+			}
+		})
+	}
+}
+
+func TestCleanupNetwork(t *testing.T) {
+	rt := container.NewFake()
+	if err := CleanupNetwork(context.Background(), rt, "insight"); err != nil {
+		t.Fatalf("CleanupNetwork: %v", err)
+	}
+	if want := []string{"network-exists insight"}; !reflect.DeepEqual(rt.Ops(), want) {
+		t.Errorf("expected a missing network to be skipped, got %q", rt.Ops())
+	}
+
+	rt = container.NewFake()
+	rt.Networks["insight"] = true
+	rt.Errors["network-rm"] = errors.New("network has active endpoints")
+	err := CleanupNetwork(context.Background(), rt, "insight")
+	checkErr(t, err, "failed to clean up network insight: network has active endpoints")
+}
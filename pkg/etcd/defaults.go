@@ -0,0 +1,50 @@
+package etcd
+
+import "time"
+
+// Default values used by the CLI when no override is supplied.
+const (
+	// DefaultEtcdImage is the etcd image used for restoring and serving snapshots.
+	DefaultEtcdImage = "quay.io/coreos/etcd:v3.5.7"
+
+	// DefaultKubeAPIServerImage is the kube-apiserver image started against the restored data.
+	DefaultKubeAPIServerImage = "registry.k8s.io/kube-apiserver:v1.27.1"
+
+	// DefaultHelperImage runs small shell steps such as copying files into volumes. It is
+	// fully qualified because podman refuses ambiguous short names by default.
+	DefaultHelperImage = "docker.io/library/alpine:3.20"
+
+	// DefaultEtcdContainerName is the name of the etcd container.
+	DefaultEtcdContainerName = "snapshot-insight-etcd"
+
+	// DefaultKubeAPIServerContainerName is the name of the kube-apiserver container.
+	DefaultKubeAPIServerContainerName = "snapshot-insight-kube-apiserver"
+
+	// DefaultEtcdVolumeName is the volume holding the restored etcd data directory.
+	DefaultEtcdVolumeName = "snapshot-insight-etcd-data"
+
+	// DefaultCertsVolumeName is the volume holding the kube-apiserver certificates.
+	DefaultCertsVolumeName = "snapshot-insight-certs"
+
+	// DefaultNetworkName is the dedicated network of the default session in bridge mode.
+	DefaultNetworkName = "snapshot-insight"
+
+	// DefaultPublishAddress is the host address published ports are bound to in bridge mode.
+	DefaultPublishAddress = "127.0.0.1"
+
+	// DefaultKubeconfigContext names the cluster, user and context of generated kubeconfigs.
+	DefaultKubeconfigContext = "snapshot-insight"
+
+	// DefaultRuntime is the container runtime used when none is selected.
+	DefaultRuntime = "docker"
+
+	// DefaultEtcdClientPort and DefaultEtcdPeerPort are the etcd ports of the default session.
+	DefaultEtcdClientPort = 2379
+	DefaultEtcdPeerPort   = 2380
+
+	// DefaultKubeAPIServerPort is the secure kube-apiserver port of the default session.
+	DefaultKubeAPIServerPort = 6443
+
+	// DefaultReadyTimeout is how long start waits for etcd and kube-apiserver to become ready.
+	DefaultReadyTimeout = 2 * time.Minute
+)
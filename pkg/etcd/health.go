@@ -0,0 +1,126 @@
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+// logTailLines is the number of container log lines included in readiness errors.
+const logTailLines = 30
+
+// pollInterval is the delay between readiness probes, shortened in tests.
+var pollInterval = time.Second
+
+// probeURL checks a health endpoint, replaced in tests.
+var probeURL = httpProbe
+
+// WaitForEtcd polls the /health endpoint of etcd until it reports healthy or the
+// timeout expires. tlsConfig authenticates to etcd serving TLS, and may be nil.
+func WaitForEtcd(ctx context.Context, rt container.Runtime, containerName, endpoint string, tlsConfig *tls.Config, timeout time.Duration) error {
+	return waitForReady(ctx, rt, "etcd", containerName, strings.TrimSuffix(endpoint, "/")+"/health", tlsConfig, timeout)
+}
+
+// WaitForKubeAPIServer polls the /readyz endpoint of kube-apiserver until it reports
+// ready or the timeout expires.
+func WaitForKubeAPIServer(ctx context.Context, rt container.Runtime, containerName, serverURL string, timeout time.Duration) error {
+	return waitForReady(ctx, rt, "kube-apiserver", containerName, strings.TrimSuffix(serverURL, "/")+"/readyz", nil, timeout)
+}
+
+// waitForReady probes url until it answers 200 OK. It gives up early when the container
+// has exited, and includes the tail of the container logs in the returned error.
+func waitForReady(ctx context.Context, rt container.Runtime, component, containerName, url string, tlsConfig *tls.Config, timeout time.Duration) error {
+	fmt.Printf("Waiting up to %s for %s to become ready at %s...\n", timeout, component, url)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := probeURL(ctx, url, tlsConfig)
+		if err == nil {
+			fmt.Printf("%s is ready.\n", component)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped waiting for %s: %w", component, ctx.Err())
+		}
+
+		if state, ok := inspectState(ctx, rt, containerName); ok && !state.State.Running {
+			return withLogs(ctx, rt, containerName, fmt.Errorf("%s container %s exited with code %d: %v", component, containerName, state.State.ExitCode, err))
+		}
+		if time.Now().After(deadline) {
+			return withLogs(ctx, rt, containerName, fmt.Errorf("%s did not become ready within %s: %v", component, timeout, err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for %s: %w", component, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// containerState is the part of the "inspect" output shared by docker, podman and nerdctl.
+type containerState struct {
+	State struct {
+		Running  bool
+		ExitCode int
+	}
+}
+
+// inspectState returns the state of a container, or false when it cannot be inspected.
+func inspectState(ctx context.Context, rt container.Runtime, containerName string) (containerState, bool) {
+	var states []containerState
+	output, err := rt.Inspect(ctx, containerName)
+	if err != nil || json.Unmarshal([]byte(output), &states) != nil || len(states) == 0 {
+		return containerState{}, false
+	}
+	return states[0], true
+}
+
+// withLogs appends the tail of the container logs to err.
+func withLogs(ctx context.Context, rt container.Runtime, containerName string, err error) error {
+	logs, logsErr := rt.Logs(ctx, containerName, logTailLines)
+	if logsErr != nil {
+		return fmt.Errorf("%v (failed to read container logs: %v)", err, logsErr)
+	}
+	if strings.TrimSpace(logs) == "" {
+		return err
+	}
+	return fmt.Errorf("%v\nlast %d lines of %s logs:\n%s", err, logTailLines, containerName, strings.TrimRight(logs, "\n"))
+}
+
+// httpProbe returns an error unless url answers 200 OK. Without tlsConfig certificates
+// are not verified: the kube-apiserver serves a self-signed certificate and only its
+// readiness is of interest here.
+func httpProbe(ctx context.Context, url string, tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
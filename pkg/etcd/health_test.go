@@ -0,0 +1,123 @@
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+func TestWaitForReady(t *testing.T) {
+	notReady := errors.New("connection refused")
+
+	tests := []struct {
+		name          string
+		probes        []error
+		inspectOutput string
+		logsOutput    string
+		wantErr       string
+		wantProbes    int
+	}{
+		{
+			name:       "ready at once",
+			probes:     []error{nil},
+			wantProbes: 1,
+		},
+		{
+			name:          "ready after a few attempts",
+			probes:        []error{notReady, notReady, nil},
+			inspectOutput: `[{"State": {"Running": true}}]`,
+			wantProbes:    3,
+		},
+		{
+			name:          "container exited",
+			probes:        []error{notReady},
+			inspectOutput: `[{"State": {"Running": false, "ExitCode": 1}}]`,
+			logsOutput:    "panic: failed to recover v3 backend from snapshot\n",
+			wantErr:       "etcd container etcd exited with code 1: connection refused\nlast 30 lines of etcd logs:\npanic: failed to recover v3 backend",
+			wantProbes:    1,
+		},
+		{
+			name:       "timeout",
+			probes:     []error{notReady},
+			logsOutput: "waiting for leader\n",
+			wantErr:    "etcd did not become ready within 20ms: connection refused\nlast 30 lines of etcd logs:\nwaiting for leader",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes := stubProbe(t, tt.probes...)
+			rt := container.NewFake()
+			rt.InspectOutput = tt.inspectOutput
+			rt.LogsOutput = tt.logsOutput
+
+			err := WaitForEtcd(context.Background(), rt, "etcd", DefaultPorts().EtcdEndpoint(false), nil, 20*time.Millisecond)
+			checkErr(t, err, tt.wantErr)
+			if tt.wantProbes > 0 && len(*probes) != tt.wantProbes {
+				t.Errorf("probed %d times, want %d", len(*probes), tt.wantProbes)
+			}
+			if (*probes)[0] != "http://127.0.0.1:2379/health" {
+				t.Errorf("probed %s, want the etcd /health endpoint", (*probes)[0])
+			}
+		})
+	}
+}
+
+func TestStartKubeAPIServerWaitsForReadyz(t *testing.T) {
+	probes := stubProbe(t, errors.New("503 Service Unavailable"))
+	rt := container.NewFake()
+	rt.LogsOutput = "E1016 storage decoding errors\n"
+
+	err := StartKubeAPIServer(context.Background(), rt, "http://127.0.0.1:2379", "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{OutputDir: t.TempDir(), Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages, ReadyTimeout: 10 * time.Millisecond})
+	checkErr(t, err, "kube-apiserver did not become ready within 10ms: 503 Service Unavailable\nlast 30 lines of apiserver logs:\nE1016 storage decoding errors")
+
+	if (*probes)[0] != "https://127.0.0.1:6443/readyz" {
+		t.Errorf("probed %s, want the kube-apiserver /readyz endpoint", (*probes)[0])
+	}
+	if logs := rt.CallsFor("logs"); len(logs) != 1 || strings.Join(logs[0].Args, " ") != "apiserver 30" {
+		t.Errorf("expected the tail of the apiserver logs to be read, got %v", logs)
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	healthy := true
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			http.Error(w, "[-]etcd failed: reason withheld", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	if err := httpProbe(context.Background(), server.URL+"/readyz", nil); err != nil {
+		t.Errorf("httpProbe on a ready server: %v", err)
+	}
+
+	healthy = false
+	err := httpProbe(context.Background(), server.URL+"/readyz", nil)
+	checkErr(t, err, "500 Internal Server Error: [-]etcd failed")
+}
+
+// stubProbe makes readiness probes return the given results in turn, repeating the
+// last one, and records the probed URLs.
+func stubProbe(t *testing.T, results ...error) *[]string {
+	t.Helper()
+
+	var probed []string
+	origProbe, origInterval := probeURL, pollInterval
+	probeURL = func(_ context.Context, url string, _ *tls.Config) error {
+		probed = append(probed, url)
+		return results[min(len(probed), len(results))-1]
+	}
+	pollInterval = time.Millisecond
+	t.Cleanup(func() { probeURL, pollInterval = origProbe, origInterval })
+	return &probed
+}
@@ -0,0 +1,136 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+// PullPolicy decides when images are pulled before a container is started.
+type PullPolicy string
+
+const (
+	// PullAlways pulls every image before it is used.
+	PullAlways PullPolicy = "always"
+	// PullIfNotPresent only pulls images missing from the local image store.
+	PullIfNotPresent PullPolicy = "if-not-present"
+	// PullNever never contacts a registry; images must be loaded beforehand.
+	PullNever PullPolicy = "never"
+)
+
+// digestPattern matches the digest of a pinned reference such as image@sha256:<hex>.
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// ParsePullPolicy validates a pull policy name.
+func ParsePullPolicy(s string) (PullPolicy, error) {
+	switch policy := PullPolicy(strings.ToLower(s)); policy {
+	case PullAlways, PullIfNotPresent, PullNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unsupported pull policy %q (expected always, if-not-present or never)", s)
+	}
+}
+
+// Images are the container images snapshot-insight runs and how they are pulled.
+type Images struct {
+	// Etcd restores and serves the snapshot.
+	Etcd string
+	// KubeAPIServer serves the restored data.
+	KubeAPIServer string
+	// Helper runs small shell steps such as copying files into volumes.
+	Helper string
+	// PullPolicy decides when the images are pulled.
+	PullPolicy PullPolicy
+}
+
+// DefaultImages returns the pinned default images with the if-not-present pull policy.
+func DefaultImages() Images {
+	return Images{
+		Etcd:          DefaultEtcdImage,
+		KubeAPIServer: DefaultKubeAPIServerImage,
+		Helper:        DefaultHelperImage,
+		PullPolicy:    PullIfNotPresent,
+	}
+}
+
+// List returns the images in the order they are used.
+func (i Images) List() []string {
+	return []string{i.Etcd, i.KubeAPIServer, i.Helper}
+}
+
+// Validate checks that every image is set and that digest pins are well formed.
+func (i Images) Validate() error {
+	for _, image := range i.List() {
+		if err := validateImage(image); err != nil {
+			return err
+		}
+	}
+	if _, err := ParsePullPolicy(string(i.PullPolicy)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WithRegistry returns the images rewritten to pull from a registry mirror,
+// e.g. quay.io/coreos/etcd:v3.5.7 becomes mirror.example.com/coreos/etcd:v3.5.7.
+func (i Images) WithRegistry(registry string) Images {
+	registry = strings.TrimSuffix(registry, "/")
+	if registry == "" {
+		return i
+	}
+
+	i.Etcd = withRegistry(i.Etcd, registry)
+	i.KubeAPIServer = withRegistry(i.KubeAPIServer, registry)
+	i.Helper = withRegistry(i.Helper, registry)
+	return i
+}
+
+// EnsureImage makes an image available according to the pull policy.
+func EnsureImage(ctx context.Context, rt container.Runtime, image string, policy PullPolicy) error {
+	switch policy {
+	case PullAlways:
+	case PullIfNotPresent, "":
+		if rt.ImageExists(ctx, image) {
+			fmt.Printf("Using local image: %s\n", image)
+			return nil
+		}
+	case PullNever:
+		if !rt.ImageExists(ctx, image) {
+			return fmt.Errorf("image %s is not present locally and the pull policy is never; load it with \"snapshot-insight images load\"", image)
+		}
+		fmt.Printf("Using local image: %s\n", image)
+		return nil
+	default:
+		return fmt.Errorf("unsupported pull policy %q", policy)
+	}
+
+	fmt.Printf("Pulling image: %s...\n", image)
+	if err := rt.Pull(ctx, image); err != nil {
+		return fmt.Errorf("failed to pull image %s: %v", image, err)
+	}
+	return nil
+}
+
+// validateImage rejects empty references and malformed digest pins.
+func validateImage(image string) error {
+	if image == "" || strings.ContainsAny(image, " \t\n") {
+		return fmt.Errorf("invalid image reference %q", image)
+	}
+	if _, digest, pinned := strings.Cut(image, "@"); pinned && !digestPattern.MatchString(digest) {
+		return fmt.Errorf("invalid digest in image reference %q (expected sha256:<64 hex characters>)", image)
+	}
+	return nil
+}
+
+// withRegistry replaces the registry of an image reference. References without
+// an explicit registry, such as "alpine", are placed under the mirror as-is.
+func withRegistry(image, registry string) string {
+	first, rest, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return registry + "/" + rest
+	}
+	return registry + "/" + image
+}
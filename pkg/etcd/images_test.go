@@ -0,0 +1,105 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+func TestEnsureImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  PullPolicy
+		present bool
+		pullErr error
+		wantErr string
+		wantOps []string
+	}{
+		{name: "always pulls present images", policy: PullAlways, present: true, wantOps: []string{"pull etcd:test"}},
+		{name: "if-not-present skips present images", policy: PullIfNotPresent, present: true, wantOps: []string{"image-exists etcd:test"}},
+		{name: "if-not-present pulls missing images", policy: PullIfNotPresent, wantOps: []string{"image-exists etcd:test", "pull etcd:test"}},
+		{name: "never uses present images", policy: PullNever, present: true, wantOps: []string{"image-exists etcd:test"}},
+		{name: "never fails on missing images", policy: PullNever, wantErr: "pull policy is never", wantOps: []string{"image-exists etcd:test"}},
+		{
+			name:    "pull failure",
+			policy:  PullAlways,
+			pullErr: errors.New("registry unreachable"),
+			wantErr: "failed to pull image etcd:test: registry unreachable",
+			wantOps: []string{"pull etcd:test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := container.NewFake()
+			rt.Images["etcd:test"] = tt.present
+			if tt.pullErr != nil {
+				rt.Errors["pull"] = tt.pullErr
+			}
+
+			checkErr(t, EnsureImage(context.Background(), rt, "etcd:test", tt.policy), tt.wantErr)
+			if !reflect.DeepEqual(rt.Ops(), tt.wantOps) {
+				t.Errorf("ops mismatch\ngot:  %q\nwant: %q", rt.Ops(), tt.wantOps)
+			}
+		})
+	}
+}
+
+func TestParsePullPolicy(t *testing.T) {
+	for _, name := range []string{"always", "If-Not-Present", "never"} {
+		if _, err := ParsePullPolicy(name); err != nil {
+			t.Errorf("ParsePullPolicy(%q): %v", name, err)
+		}
+	}
+	if _, err := ParsePullPolicy("sometimes"); err == nil {
+		t.Error("expected error for unknown pull policy")
+	}
+}
+
+func TestImagesWithRegistry(t *testing.T) {
+	images := Images{
+		Etcd:          "quay.io/coreos/etcd:v3.5.7",
+		KubeAPIServer: "registry.k8s.io/kube-apiserver@sha256:" + strings.Repeat("a", 64),
+		Helper:        "alpine:3.20",
+	}
+
+	got := images.WithRegistry("mirror.example.com:5000/")
+	want := Images{
+		Etcd:          "mirror.example.com:5000/coreos/etcd:v3.5.7",
+		KubeAPIServer: "mirror.example.com:5000/kube-apiserver@sha256:" + strings.Repeat("a", 64),
+		Helper:        "mirror.example.com:5000/alpine:3.20",
+	}
+	if got != want {
+		t.Errorf("WithRegistry() = %+v, want %+v", got, want)
+	}
+
+	if unchanged := images.WithRegistry(""); unchanged != images {
+		t.Errorf("WithRegistry(\"\") = %+v, want %+v", unchanged, images)
+	}
+}
+
+func TestImagesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Images)
+		wantErr string
+	}{
+		{name: "defaults", modify: func(*Images) {}},
+		{name: "digest pin", modify: func(i *Images) { i.Etcd = "quay.io/coreos/etcd@sha256:" + strings.Repeat("0", 64) }},
+		{name: "short digest", modify: func(i *Images) { i.Etcd = "quay.io/coreos/etcd@sha256:abc" }, wantErr: "invalid digest"},
+		{name: "empty image", modify: func(i *Images) { i.Helper = "" }, wantErr: "invalid image reference"},
+		{name: "bad policy", modify: func(i *Images) { i.PullPolicy = "sometimes" }, wantErr: "unsupported pull policy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := DefaultImages()
+			tt.modify(&images)
+			checkErr(t, images.Validate(), tt.wantErr)
+		})
+	}
+}
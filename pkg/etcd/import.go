@@ -0,0 +1,217 @@
+package etcd
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/supporttools/snapshot-insight/pkg/backup"
+)
+
+// sourcePKI is where a distribution keeps the credentials reused from the source cluster,
+// relative to a node's filesystem root. Files that may be missing are left empty.
+type sourcePKI struct {
+	dir                        string
+	caCert, caKey              string
+	saKey, saCurrentKey, saPub string
+}
+
+// sourcePKIs are the known layouts. RKE2 and k3s sign client certificates with client-ca
+// and keep the service account verification keys in service.key; newer releases sign
+// tokens with service.current.key.
+var sourcePKIs = []sourcePKI{
+	{dir: "etc/kubernetes/pki", caCert: "ca.crt", caKey: "ca.key", saKey: "sa.key", saPub: "sa.pub"},
+	{dir: "var/lib/rancher/rke2/server/tls", caCert: "client-ca.crt", caKey: "client-ca.key", saKey: "service.key", saCurrentKey: "service.current.key"},
+	{dir: "var/lib/rancher/k3s/server/tls", caCert: "client-ca.crt", caKey: "client-ca.key", saKey: "service.key", saCurrentKey: "service.current.key"},
+}
+
+// FindPKIInBackup locates the CA and service account keys in a backup of a control plane
+// node and returns them as PKIOptions. root may be the node's filesystem root or any
+// directory below it, such as a copy of /etc/kubernetes/pki or /var/lib/rancher/rke2.
+func FindPKIInBackup(root string) (PKIOptions, error) {
+	if _, err := os.Stat(root); err != nil {
+		return PKIOptions{}, fmt.Errorf("failed to read backup: %v", err)
+	}
+
+	for _, layout := range sourcePKIs {
+		caCert, ok := backup.Find(root, filepath.Join(layout.dir, layout.caCert))
+		if !ok {
+			continue
+		}
+		dir := filepath.Dir(caCert)
+		opts := PKIOptions{CACert: caCert, CAKey: filepath.Join(dir, layout.caKey)}
+		if _, err := os.Stat(opts.CAKey); err != nil {
+			return PKIOptions{}, fmt.Errorf("%s has no CA key %s: %v", dir, layout.caKey, err)
+		}
+
+		saKey := filepath.Join(dir, layout.saKey)
+		if _, err := os.Stat(saKey); err != nil {
+			return PKIOptions{}, fmt.Errorf("%s has no service account key %s: %v", dir, layout.saKey, err)
+		}
+		opts.SAKey = saKey
+		if layout.saPub != "" {
+			opts.SAPub = filepath.Join(dir, layout.saPub)
+		}
+		if layout.saCurrentKey != "" {
+			if current := filepath.Join(dir, layout.saCurrentKey); backup.FileExists(current) {
+				// service.key still verifies the tokens signed before the last rotation
+				opts.SAKey, opts.SAPub = current, saKey
+			}
+		}
+		return opts, nil
+	}
+
+	return PKIOptions{}, fmt.Errorf("no kubeadm, RKE2 or k3s CA found in %s", root)
+}
+
+// ImportBackup takes the CA and service account keys from a backup of a control plane
+// node, see FindPKIInBackup. The other options, such as the certificate validity, are kept.
+func (o *PKIOptions) ImportBackup(root string) error {
+	found, err := FindPKIInBackup(root)
+	if err != nil {
+		return err
+	}
+	o.CACert, o.CAKey = found.CACert, found.CAKey
+	o.SAKey, o.SAPub = found.SAKey, found.SAPub
+	return nil
+}
+
+// importCA copies an existing CA into certPath and keyPath after checking that the key
+// belongs to the certificate.
+func importCA(srcCert, srcKey, certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	if srcCert == "" || srcKey == "" {
+		return nil, nil, fmt.Errorf("both the CA certificate and its key are needed to import a CA")
+	}
+	caCert, caKey, err := loadCA(srcCert, srcKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !caCert.IsCA {
+		return nil, nil, fmt.Errorf("%s is not a CA certificate", srcCert)
+	}
+
+	if err := copyFile(srcCert, certPath); err != nil {
+		return nil, nil, fmt.Errorf("failed to copy CA certificate: %v", err)
+	}
+	if err := copyFile(srcKey, keyPath); err != nil {
+		return nil, nil, fmt.Errorf("failed to copy CA private key: %v", err)
+	}
+	return caCert, caKey, nil
+}
+
+// importServiceAccountKey copies an existing service account signing key to keyPath and
+// writes the verification keys to pubPath. srcPub may hold public or private keys; when it
+// is empty the public key of srcKey is used.
+func importServiceAccountKey(srcKey, srcPub, keyPath, pubPath string) error {
+	if _, err := readPrivateKey(srcKey); err != nil {
+		return fmt.Errorf("failed to load service account key: %v", err)
+	}
+	if srcPub == "" {
+		srcPub = srcKey
+	}
+	pubPEM, err := publicKeysPEM(srcPub)
+	if err != nil {
+		return fmt.Errorf("failed to load service account public keys: %v", err)
+	}
+
+	if err := copyFile(srcKey, keyPath); err != nil {
+		return fmt.Errorf("failed to copy service account key: %v", err)
+	}
+	if err := os.WriteFile(pubPath, pubPEM, 0o600); err != nil {
+		return fmt.Errorf("failed to write service account public key: %v", err)
+	}
+	return nil
+}
+
+// readPrivateKey reads the first private key of a PEM file in PKCS#1, SEC 1 or PKCS#8 form.
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if key, ok, err := parsePrivateKey(block); ok {
+			return key, err
+		}
+	}
+	return nil, fmt.Errorf("no private key found in %s", path)
+}
+
+// parsePrivateKey parses a PEM block holding a private key. ok is false for other blocks,
+// such as the EC PARAMETERS openssl writes before EC keys.
+func parsePrivateKey(block *pem.Block) (key crypto.Signer, ok bool, err error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		if parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			if key, ok = parsed.(crypto.Signer); !ok {
+				return nil, true, fmt.Errorf("unsupported private key type %T", parsed)
+			}
+		}
+	default:
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return key, true, nil
+}
+
+// publicKeysPEM returns every public key of a PEM file as PKIX PUBLIC KEY blocks, deriving
+// them from private keys where needed.
+func publicKeysPEM(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		var pub any
+		switch block.Type {
+		case "PUBLIC KEY":
+			if pub, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		case "RSA PUBLIC KEY":
+			if pub, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		default:
+			key, ok, err := parsePrivateKey(block)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			pub = key.Public()
+		}
+
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no keys found in %s", path)
+	}
+	return out, nil
+}
+
+// copyFile copies src to dst, readable by the owner only.
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o600)
+}
@@ -0,0 +1,260 @@
+package etcd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFindPKIInBackup(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		root    string
+		want    PKIOptions
+		wantErr string
+	}{
+		{
+			name:  "kubeadm node root",
+			files: []string{"etc/kubernetes/pki/ca.crt", "etc/kubernetes/pki/ca.key", "etc/kubernetes/pki/sa.key", "etc/kubernetes/pki/sa.pub"},
+			want:  PKIOptions{CACert: "etc/kubernetes/pki/ca.crt", CAKey: "etc/kubernetes/pki/ca.key", SAKey: "etc/kubernetes/pki/sa.key", SAPub: "etc/kubernetes/pki/sa.pub"},
+		},
+		{
+			name:  "copy of the pki directory",
+			files: []string{"pki/ca.crt", "pki/ca.key", "pki/sa.key", "pki/sa.pub"},
+			root:  "pki",
+			want:  PKIOptions{CACert: "pki/ca.crt", CAKey: "pki/ca.key", SAKey: "pki/sa.key", SAPub: "pki/sa.pub"},
+		},
+		{
+			name:  "rke2",
+			files: []string{"rke2/server/tls/client-ca.crt", "rke2/server/tls/client-ca.key", "rke2/server/tls/service.key"},
+			want:  PKIOptions{CACert: "rke2/server/tls/client-ca.crt", CAKey: "rke2/server/tls/client-ca.key", SAKey: "rke2/server/tls/service.key"},
+		},
+		{
+			name:  "k3s with a rotated service account key",
+			files: []string{"k3s/server/tls/client-ca.crt", "k3s/server/tls/client-ca.key", "k3s/server/tls/service.key", "k3s/server/tls/service.current.key"},
+			want:  PKIOptions{CACert: "k3s/server/tls/client-ca.crt", CAKey: "k3s/server/tls/client-ca.key", SAKey: "k3s/server/tls/service.current.key", SAPub: "k3s/server/tls/service.key"},
+		},
+		{
+			name:    "missing CA key",
+			files:   []string{"etc/kubernetes/pki/ca.crt", "etc/kubernetes/pki/sa.key"},
+			wantErr: "has no CA key ca.key",
+		},
+		{
+			name:    "missing service account key",
+			files:   []string{"server/tls/client-ca.crt", "server/tls/client-ca.key"},
+			wantErr: "has no service account key service.key",
+		},
+		{
+			name:    "no CA",
+			files:   []string{"etc/kubernetes/admin.conf"},
+			wantErr: "no kubeadm, RKE2 or k3s CA found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, file := range tt.files {
+				path := filepath.Join(dir, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := FindPKIInBackup(filepath.Join(dir, tt.root))
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			for _, path := range []*string{&tt.want.CACert, &tt.want.CAKey, &tt.want.SAKey, &tt.want.SAPub} {
+				if *path != "" {
+					*path = filepath.Join(dir, *path)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindPKIInBackup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeneratePKIWithImportedKeys(t *testing.T) {
+	src := t.TempDir()
+	caCertPath, caKeyPath := writeRSACA(t, src)
+	oldKey := writeRSAKey(t, filepath.Join(src, "service.key"))
+	currentKey := writeRSAKey(t, filepath.Join(src, "service.current.key"))
+
+	dir := t.TempDir()
+	opts := PKIOptions{
+		EtcdHosts: []string{"etcd"},
+		CACert:    caCertPath,
+		CAKey:     caKeyPath,
+		SAKey:     filepath.Join(src, "service.current.key"),
+		SAPub:     filepath.Join(src, "service.key"),
+	}
+	if err := GeneratePKI(dir, "192.0.2.10", opts); err != nil {
+		t.Fatalf("GeneratePKI: %v", err)
+	}
+
+	srcCA, _ := os.ReadFile(caCertPath)
+	gotCA, _ := os.ReadFile(filepath.Join(dir, caCertFile))
+	if !bytes.Equal(srcCA, gotCA) {
+		t.Errorf("ca.crt is not the imported CA")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(readCert(t, caCertPath))
+	for _, file := range []string{apiServerCertFile, adminCertFile, etcdServerCertFile} {
+		cert := readCert(t, filepath.Join(dir, file))
+		if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+			t.Errorf("%s is not signed by the imported CA: %v", file, err)
+		}
+		if got := cert.NotAfter.Sub(cert.NotBefore); got != ImportedCACertValidity {
+			t.Errorf("%s is valid for %s, want %s", file, got, ImportedCACertValidity)
+		}
+	}
+
+	signing, err := readPrivateKey(filepath.Join(dir, saKeyFile))
+	if err != nil {
+		t.Fatalf("failed to read sa.key: %v", err)
+	}
+	if !currentKey.Equal(signing) {
+		t.Errorf("sa.key is not the imported signing key")
+	}
+	pubPEM, err := os.ReadFile(filepath.Join(dir, saPubFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(pubPEM)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		t.Fatalf("sa.pub is not a PEM public key: %s", pubPEM)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse sa.pub: %v", err)
+	}
+	if !oldKey.PublicKey.Equal(pub) {
+		t.Errorf("sa.pub does not hold the public key of service.key")
+	}
+}
+
+func TestImportBackupKeepsCertOptions(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "etc", "kubernetes", "pki")
+	if err := os.MkdirAll(src, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeRSACA(t, src)
+	saKey := writeRSAKey(t, filepath.Join(src, "sa.key"))
+	if err := writePEMFile(filepath.Join(src, "sa.pub"), "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&saKey.PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := PKIOptions{Certs: CertOptions{Validity: 2 * time.Hour}}
+	if err := opts.ImportBackup(src); err != nil {
+		t.Fatalf("ImportBackup: %v", err)
+	}
+	if opts.CACert != filepath.Join(src, "ca.crt") || opts.SAKey != filepath.Join(src, "sa.key") {
+		t.Errorf("unexpected imported keys: %+v", opts)
+	}
+
+	dir := t.TempDir()
+	if err := GeneratePKI(dir, "192.0.2.10", opts); err != nil {
+		t.Fatalf("GeneratePKI: %v", err)
+	}
+	for _, file := range []string{apiServerCertFile, adminCertFile} {
+		cert := readCert(t, filepath.Join(dir, file))
+		if got := cert.NotAfter.Sub(cert.NotBefore); got != 2*time.Hour {
+			t.Errorf("%s is valid for %s, want 2h", file, got)
+		}
+	}
+}
+
+func TestGeneratePKIImportErrors(t *testing.T) {
+	src := t.TempDir()
+	caCertPath, caKeyPath := writeRSACA(t, src)
+	writeRSAKey(t, filepath.Join(src, "other.key"))
+
+	tests := []struct {
+		name    string
+		opts    PKIOptions
+		wantErr string
+	}{
+		{
+			name:    "CA without key",
+			opts:    PKIOptions{CACert: caCertPath},
+			wantErr: "both the CA certificate and its key are needed",
+		},
+		{
+			name:    "mismatched CA key",
+			opts:    PKIOptions{CACert: caCertPath, CAKey: filepath.Join(src, "other.key")},
+			wantErr: "does not match certificate",
+		},
+		{
+			name:    "service account key is not a key",
+			opts:    PKIOptions{CACert: caCertPath, CAKey: caKeyPath, SAKey: caCertPath},
+			wantErr: "failed to load service account key: no private key found",
+		},
+		{
+			name:    "public key without signing key",
+			opts:    PKIOptions{SAPub: filepath.Join(src, "other.key")},
+			wantErr: "a service account public key needs its signing key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErr(t, GeneratePKI(t.TempDir(), "192.0.2.10", tt.opts), tt.wantErr)
+		})
+	}
+}
+
+// writeRSACA writes a self-signed CA with a PKCS#1 RSA key, like the ones kubeadm creates.
+func writeRSACA(t *testing.T, dir string) (certPath, keyPath string) {
+	t.Helper()
+
+	certPath, keyPath = filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	key := writeRSAKey(t, keyPath)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubernetes"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writePEMFile(certPath, "CERTIFICATE", der); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+// writeRSAKey writes a new PKCS#1 RSA private key to path.
+func writeRSAKey(t *testing.T, path string) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writePEMFile(path, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
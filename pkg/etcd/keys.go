@@ -0,0 +1,149 @@
+package etcd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// KeyAlgorithm is the type and size of generated private keys.
+type KeyAlgorithm string
+
+const (
+	KeyRSA2048   KeyAlgorithm = "rsa-2048"
+	KeyRSA4096   KeyAlgorithm = "rsa-4096"
+	KeyECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	KeyECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	KeyEd25519   KeyAlgorithm = "ed25519"
+)
+
+// KeyAlgorithms lists the supported key algorithms.
+var KeyAlgorithms = []KeyAlgorithm{KeyRSA2048, KeyRSA4096, KeyECDSAP256, KeyECDSAP384, KeyEd25519}
+
+// ParseKeyAlgorithm validates a key algorithm given on the command line.
+func ParseKeyAlgorithm(s string) (KeyAlgorithm, error) {
+	for _, algorithm := range KeyAlgorithms {
+		if KeyAlgorithm(strings.ToLower(s)) == algorithm {
+			return algorithm, nil
+		}
+	}
+	return "", fmt.Errorf("unknown key algorithm %q, expected one of %v", s, KeyAlgorithms)
+}
+
+// DefaultCertValidity is the lifetime of generated certificates.
+const DefaultCertValidity = 365 * 24 * time.Hour
+
+// ImportedCACertValidity is the default lifetime of certificates signed by an imported CA.
+// The source cluster accepts them too, so they should not outlive the investigation.
+const ImportedCACertValidity = 24 * time.Hour
+
+// serialNumberBits is the size of the random certificate serial numbers.
+const serialNumberBits = 128
+
+// CertOptions control how certificates are generated. The zero value generates ECDSA
+// P-256 keys and certificates valid for DefaultCertValidity.
+type CertOptions struct {
+	// KeyAlgorithm of the generated keys.
+	KeyAlgorithm KeyAlgorithm
+	// Validity is the lifetime of the generated certificates.
+	Validity time.Duration
+	// DNSNames and IPAddresses are added to the serving certificates.
+	DNSNames    []string
+	IPAddresses []net.IP
+}
+
+// AddSANs adds subject alternative names, sorting IP addresses from DNS names.
+func (o *CertOptions) AddSANs(sans ...string) {
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			o.IPAddresses = append(o.IPAddresses, ip)
+		} else if san != "" {
+			o.DNSNames = append(o.DNSNames, san)
+		}
+	}
+}
+
+// keyAlgorithm returns the configured key algorithm or the default.
+func (o CertOptions) keyAlgorithm() KeyAlgorithm {
+	if o.KeyAlgorithm == "" {
+		return KeyECDSAP256
+	}
+	return o.KeyAlgorithm
+}
+
+// validity returns the configured lifetime or the default.
+func (o CertOptions) validity() time.Duration {
+	if o.Validity <= 0 {
+		return DefaultCertValidity
+	}
+	return o.Validity
+}
+
+// stamp sets a random serial number, the validity period and the key usage matching
+// the key algorithm on template.
+func (o CertOptions) stamp(template *x509.Certificate) error {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now()
+	template.NotAfter = template.NotBefore.Add(o.validity())
+
+	// Key encipherment only applies to RSA key exchange
+	if !template.IsCA && strings.HasPrefix(string(o.keyAlgorithm()), "rsa-") {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	return nil
+}
+
+// generateKey creates a private key of the algorithm.
+func generateKey(algorithm KeyAlgorithm) (crypto.Signer, error) {
+	switch algorithm {
+	case KeyRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case KeyECDSAP256, "":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unknown key algorithm %q", algorithm)
+}
+
+// marshalPrivateKey encodes a private key in the PEM block type kubeadm writes for it:
+// PKCS#1 for RSA, SEC 1 for ECDSA and PKCS#8 for Ed25519.
+func marshalPrivateKey(key crypto.Signer) (blockType string, der []byte, err error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(k), nil
+	case *ecdsa.PrivateKey:
+		der, err = x509.MarshalECPrivateKey(k)
+		return "EC PRIVATE KEY", der, err
+	default:
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+		return "PRIVATE KEY", der, err
+	}
+}
+
+// writePrivateKey writes a private key to a PEM file readable by the owner only.
+func writePrivateKey(path string, key crypto.Signer) error {
+	blockType, der, err := marshalPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %v", err)
+	}
+	return writePEMFile(path, blockType, der)
+}
@@ -0,0 +1,133 @@
+package etcd
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseKeyAlgorithm(t *testing.T) {
+	for _, algorithm := range KeyAlgorithms {
+		got, err := ParseKeyAlgorithm(string(algorithm))
+		if err != nil || got != algorithm {
+			t.Errorf("ParseKeyAlgorithm(%q) = %q, %v", algorithm, got, err)
+		}
+	}
+	if got, err := ParseKeyAlgorithm("ECDSA-P384"); err != nil || got != KeyECDSAP384 {
+		t.Errorf("ParseKeyAlgorithm is case sensitive: %q, %v", got, err)
+	}
+	_, err := ParseKeyAlgorithm("dsa")
+	checkErr(t, err, `unknown key algorithm "dsa"`)
+}
+
+func TestCertOptionsAddSANs(t *testing.T) {
+	var opts CertOptions
+	opts.AddSANs("snapshot.example.com", "192.0.2.20", "", "2001:db8::1")
+
+	if want := []string{"snapshot.example.com"}; !reflect.DeepEqual(opts.DNSNames, want) {
+		t.Errorf("DNSNames = %v, want %v", opts.DNSNames, want)
+	}
+	if want := []net.IP{net.ParseIP("192.0.2.20"), net.ParseIP("2001:db8::1")}; !reflect.DeepEqual(opts.IPAddresses, want) {
+		t.Errorf("IPAddresses = %v, want %v", opts.IPAddresses, want)
+	}
+}
+
+func TestGeneratePKIKeyAlgorithms(t *testing.T) {
+	tests := []struct {
+		algorithm KeyAlgorithm
+		check     func(any) bool
+		saKey     func(any) bool
+	}{
+		{
+			algorithm: KeyRSA2048,
+			check:     func(k any) bool { k2, ok := k.(*rsa.PublicKey); return ok && k2.N.BitLen() == 2048 },
+			saKey:     func(k any) bool { _, ok := k.(*rsa.PublicKey); return ok },
+		},
+		{
+			algorithm: KeyECDSAP384,
+			check:     func(k any) bool { k2, ok := k.(*ecdsa.PublicKey); return ok && k2.Curve.Params().Name == "P-384" },
+			saKey:     func(k any) bool { _, ok := k.(*ecdsa.PublicKey); return ok },
+		},
+		{
+			algorithm: KeyEd25519,
+			check:     func(k any) bool { _, ok := k.(ed25519.PublicKey); return ok },
+			// kube-apiserver cannot sign service account tokens with Ed25519
+			saKey: func(k any) bool { _, ok := k.(*ecdsa.PublicKey); return ok },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			dir := t.TempDir()
+			opts := PKIOptions{EtcdHosts: []string{"etcd"}, Certs: CertOptions{KeyAlgorithm: tt.algorithm, Validity: 48 * time.Hour}}
+			opts.Certs.AddSANs("snapshot.example.com", "192.0.2.20")
+			if err := GeneratePKI(dir, "192.0.2.10", opts); err != nil {
+				t.Fatalf("GeneratePKI: %v", err)
+			}
+
+			ca := readCert(t, filepath.Join(dir, caCertFile))
+			roots := x509.NewCertPool()
+			roots.AddCert(ca)
+			serials := map[string]bool{}
+			for _, file := range []string{caCertFile, apiServerCertFile, adminCertFile, etcdServerCertFile, etcdPeerCertFile, etcdClientCertFile} {
+				cert := readCert(t, filepath.Join(dir, file))
+				if !tt.check(cert.PublicKey) {
+					t.Errorf("%s has a %T key, want %s", file, cert.PublicKey, tt.algorithm)
+				}
+				if got := cert.NotAfter.Sub(cert.NotBefore); got != 48*time.Hour {
+					t.Errorf("%s is valid for %v, want 48h", file, got)
+				}
+				if cert.SerialNumber.BitLen() > serialNumberBits || serials[cert.SerialNumber.String()] {
+					t.Errorf("%s serial %v is not a unique 128-bit number", file, cert.SerialNumber)
+				}
+				serials[cert.SerialNumber.String()] = true
+			}
+
+			for _, pair := range [][2]string{{apiServerCertFile, apiServerKeyFile}, {adminCertFile, adminKeyFile}, {etcdClientCertFile, etcdClientKeyFile}} {
+				if _, err := tls.LoadX509KeyPair(filepath.Join(dir, pair[0]), filepath.Join(dir, pair[1])); err != nil {
+					t.Errorf("failed to load %s: %v", pair[0], err)
+				}
+			}
+
+			serving := readCert(t, filepath.Join(dir, apiServerCertFile))
+			for _, host := range []string{"snapshot.example.com", "192.0.2.20", "kubernetes.default.svc"} {
+				if _, err := serving.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+					t.Errorf("serving certificate does not verify for %s: %v", host, err)
+				}
+			}
+
+			saKey, err := readPrivateKey(filepath.Join(dir, saKeyFile))
+			if err != nil {
+				t.Fatalf("failed to read sa.key: %v", err)
+			}
+			if !tt.saKey(saKey.Public()) {
+				t.Errorf("unexpected service account key type %T", saKey)
+			}
+		})
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	if testing.Short() {
+		t.Skip("RSA-4096 key generation is slow")
+	}
+	for _, algorithm := range KeyAlgorithms {
+		key, err := generateKey(algorithm)
+		if err != nil {
+			t.Errorf("generateKey(%s): %v", algorithm, err)
+			continue
+		}
+		if _, _, err := marshalPrivateKey(key); err != nil {
+			t.Errorf("marshalPrivateKey(%s): %v", algorithm, err)
+		}
+	}
+	_, err := generateKey("dsa")
+	checkErr(t, err, `unknown key algorithm "dsa"`)
+}
@@ -0,0 +1,138 @@
+package etcd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/supporttools/snapshot-insight/pkg/kubeconfig"
+)
+
+// UserType is how the user of a generated kubeconfig authenticates.
+type UserType string
+
+const (
+	// UserCertificate embeds a client certificate and key.
+	UserCertificate UserType = "certificate"
+	// UserToken embeds a static token.
+	UserToken UserType = "token"
+	// UserExec runs an exec credential plugin that reads the client certificate
+	// from the PKI directory, so that no key is copied into the kubeconfig.
+	UserExec UserType = "exec"
+)
+
+// UserTypes lists the supported kubeconfig user types.
+var UserTypes = []UserType{UserCertificate, UserToken, UserExec}
+
+// ParseUserType validates a kubeconfig user type given on the command line.
+func ParseUserType(s string) (UserType, error) {
+	for _, userType := range UserTypes {
+		if UserType(strings.ToLower(s)) == userType {
+			return userType, nil
+		}
+	}
+	return "", fmt.Errorf("unknown kubeconfig user type %q, expected one of %v", s, UserTypes)
+}
+
+// KubeconfigOptions customise a generated kubeconfig.
+type KubeconfigOptions struct {
+	// Context names the cluster, user and context; DefaultKubeconfigContext when empty.
+	Context string
+	// Namespace is the default namespace of the context.
+	Namespace string
+	// User selects the credentials of the user; UserCertificate when empty.
+	User UserType
+	// ExecCommand is the command and arguments of the exec credential plugin for UserExec.
+	// It must print the result of ExecCredential.
+	ExecCommand []string
+	// ReadOnly uses the viewer credentials, for a kube-apiserver started in read-only mode.
+	ReadOnly bool
+	// Merge adds the context to an existing kubeconfig instead of overwriting it.
+	Merge bool
+}
+
+// GenerateKubeconfig writes a kubeconfig for the kube-apiserver at serverURL, using the
+// CA and the admin or viewer credentials of the PKI in pkiDir.
+func GenerateKubeconfig(kubeconfigPath, serverURL, pkiDir string, opts KubeconfigOptions) error {
+	client := adminUser
+	if opts.ReadOnly {
+		client = viewerUser
+	}
+
+	caCert, err := os.ReadFile(filepath.Join(pkiDir, caCertFile))
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+
+	var user kubeconfig.User
+	switch opts.User {
+	case UserCertificate, "":
+		if user.ClientCertificateData, err = os.ReadFile(filepath.Join(pkiDir, client.certFile)); err != nil {
+			return fmt.Errorf("failed to read client certificate: %v", err)
+		}
+		if user.ClientKeyData, err = os.ReadFile(filepath.Join(pkiDir, client.keyFile)); err != nil {
+			return fmt.Errorf("failed to read client key: %v", err)
+		}
+	case UserToken:
+		if user.Token, err = readToken(filepath.Join(pkiDir, tokenFile), client); err != nil {
+			return err
+		}
+	case UserExec:
+		if len(opts.ExecCommand) == 0 {
+			return fmt.Errorf("an exec credential user needs a command")
+		}
+		user.Exec = &kubeconfig.ExecConfig{
+			APIVersion:      kubeconfig.ExecCredentialAPIVersion,
+			Command:         opts.ExecCommand[0],
+			Args:            opts.ExecCommand[1:],
+			InteractiveMode: "Never",
+		}
+	default:
+		return fmt.Errorf("unknown kubeconfig user type %q", opts.User)
+	}
+
+	name := opts.Context
+	if name == "" {
+		name = DefaultKubeconfigContext
+	}
+	config := kubeconfig.New(name, serverURL, caCert, user, opts.Namespace)
+
+	if opts.Merge {
+		if err := kubeconfig.Merge(kubeconfigPath, config); err != nil {
+			return err
+		}
+		fmt.Printf("Context %s merged into kubeconfig %s\n", name, kubeconfigPath)
+		return nil
+	}
+	if err := config.Write(kubeconfigPath); err != nil {
+		return err
+	}
+	fmt.Printf("Kubeconfig generated at: %s\n", kubeconfigPath)
+	return nil
+}
+
+// ExecCredential returns the admin client certificate of the PKI in pkiDir, or the viewer
+// one when readOnly is set, as the output of an exec credential plugin.
+func ExecCredential(pkiDir string, readOnly bool) (*kubeconfig.ExecCredential, error) {
+	client := adminUser
+	if readOnly {
+		client = viewerUser
+	}
+	cert, err := os.ReadFile(filepath.Join(pkiDir, client.certFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificate: %v", err)
+	}
+	key, err := os.ReadFile(filepath.Join(pkiDir, client.keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client key: %v", err)
+	}
+	return &kubeconfig.ExecCredential{
+		APIVersion: kubeconfig.ExecCredentialAPIVersion,
+		Kind:       "ExecCredential",
+		Status: kubeconfig.ExecCredentialStatus{
+			ClientCertificateData: string(cert),
+			ClientKeyData:         string(key),
+		},
+	}, nil
+}
@@ -0,0 +1,168 @@
+package etcd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/kubeconfig"
+	"sigs.k8s.io/yaml"
+)
+
+func TestGenerateKubeconfig(t *testing.T) {
+	pkiDir := t.TempDir()
+	if err := GeneratePKI(pkiDir, "192.0.2.10", PKIOptions{}); err != nil {
+		t.Fatalf("GeneratePKI: %v", err)
+	}
+	read := func(file string) []byte {
+		data, err := os.ReadFile(filepath.Join(pkiDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	token, err := readToken(filepath.Join(pkiDir, tokenFile), adminUser)
+	if err != nil {
+		t.Fatalf("readToken: %v", err)
+	}
+	viewerToken, err := readToken(filepath.Join(pkiDir, tokenFile), viewerUser)
+	if err != nil {
+		t.Fatalf("readToken: %v", err)
+	}
+	if viewerToken == token {
+		t.Fatalf("admin and viewer share a token")
+	}
+
+	tests := []struct {
+		name     string
+		opts     KubeconfigOptions
+		wantName string
+		wantUser kubeconfig.User
+	}{
+		{
+			name:     "certificate",
+			opts:     KubeconfigOptions{},
+			wantName: DefaultKubeconfigContext,
+			wantUser: kubeconfig.User{ClientCertificateData: read(adminCertFile), ClientKeyData: read(adminKeyFile)},
+		},
+		{
+			name:     "token",
+			opts:     KubeconfigOptions{Context: "snapshot-insight-default-etcd", Namespace: "kube-system", User: UserToken},
+			wantName: "snapshot-insight-default-etcd",
+			wantUser: kubeconfig.User{Token: token},
+		},
+		{
+			name:     "read-only certificate",
+			opts:     KubeconfigOptions{ReadOnly: true},
+			wantName: DefaultKubeconfigContext,
+			wantUser: kubeconfig.User{ClientCertificateData: read(viewerCertFile), ClientKeyData: read(viewerKeyFile)},
+		},
+		{
+			name:     "read-only token",
+			opts:     KubeconfigOptions{ReadOnly: true, User: UserToken},
+			wantName: DefaultKubeconfigContext,
+			wantUser: kubeconfig.User{Token: viewerToken},
+		},
+		{
+			name:     "exec",
+			opts:     KubeconfigOptions{Context: "exec", User: UserExec, ExecCommand: []string{"/usr/bin/snapshot-insight", "--session", "default", "credential"}},
+			wantName: "exec",
+			wantUser: kubeconfig.User{Exec: &kubeconfig.ExecConfig{
+				APIVersion:      kubeconfig.ExecCredentialAPIVersion,
+				Command:         "/usr/bin/snapshot-insight",
+				Args:            []string{"--session", "default", "credential"},
+				InteractiveMode: "Never",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "kubeconfig")
+			if err := GenerateKubeconfig(path, "https://127.0.0.1:6443", pkiDir, tt.opts); err != nil {
+				t.Fatalf("GenerateKubeconfig: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := &kubeconfig.Config{}
+			if err := yaml.Unmarshal(data, config); err != nil {
+				t.Fatalf("failed to parse kubeconfig: %v", err)
+			}
+			want := kubeconfig.New(tt.wantName, "https://127.0.0.1:6443", read(caCertFile), tt.wantUser, tt.opts.Namespace)
+			if !reflect.DeepEqual(config, want) {
+				t.Errorf("kubeconfig mismatch\ngot:  %+v\nwant: %+v", config, want)
+			}
+		})
+	}
+}
+
+func TestGenerateKubeconfigMerge(t *testing.T) {
+	pkiDir := t.TempDir()
+	if err := GeneratePKI(pkiDir, "192.0.2.10", PKIOptions{}); err != nil {
+		t.Fatalf("GeneratePKI: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "config")
+
+	for _, name := range []string{"first", "second"} {
+		if err := GenerateKubeconfig(path, "https://127.0.0.1:6443", pkiDir, KubeconfigOptions{Context: name, Merge: true}); err != nil {
+			t.Fatalf("GenerateKubeconfig(%s): %v", name, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &kubeconfig.Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		t.Fatalf("failed to parse kubeconfig: %v", err)
+	}
+	if len(config.Contexts) != 2 || config.CurrentContext != "second" {
+		t.Errorf("expected both contexts with the second current, got %+v", config)
+	}
+}
+
+func TestGenerateKubeconfigErrors(t *testing.T) {
+	pkiDir := t.TempDir()
+	if err := GeneratePKI(pkiDir, "192.0.2.10", PKIOptions{}); err != nil {
+		t.Fatalf("GeneratePKI: %v", err)
+	}
+
+	err := GenerateKubeconfig(filepath.Join(t.TempDir(), "kubeconfig"), "https://127.0.0.1:6443", t.TempDir(), KubeconfigOptions{})
+	checkErr(t, err, "failed to read CA certificate")
+
+	err = GenerateKubeconfig(filepath.Join(t.TempDir(), "kubeconfig"), "https://127.0.0.1:6443", pkiDir, KubeconfigOptions{User: UserExec})
+	checkErr(t, err, "an exec credential user needs a command")
+}
+
+func TestExecCredential(t *testing.T) {
+	pkiDir := t.TempDir()
+	if err := GeneratePKI(pkiDir, "192.0.2.10", PKIOptions{}); err != nil {
+		t.Fatalf("GeneratePKI: %v", err)
+	}
+
+	for readOnly, certFile := range map[bool]string{false: adminCertFile, true: viewerCertFile} {
+		credential, err := ExecCredential(pkiDir, readOnly)
+		if err != nil {
+			t.Fatalf("ExecCredential: %v", err)
+		}
+		cert, _ := os.ReadFile(filepath.Join(pkiDir, certFile))
+		if credential.Kind != "ExecCredential" || credential.Status.ClientCertificateData != string(cert) || credential.Status.ClientKeyData == "" {
+			t.Errorf("unexpected credential for read-only %v: %+v", readOnly, credential)
+		}
+	}
+}
+
+func TestParseUserType(t *testing.T) {
+	for _, userType := range UserTypes {
+		if got, err := ParseUserType(string(userType)); err != nil || got != userType {
+			t.Errorf("ParseUserType(%q) = %q, %v", userType, got, err)
+		}
+	}
+	_, err := ParseUserType("basic")
+	checkErr(t, err, `unknown kubeconfig user type "basic"`)
+}
@@ -0,0 +1,100 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+// NetworkMode decides how the etcd and kube-apiserver containers are connected.
+type NetworkMode string
+
+const (
+	// NetworkBridge runs the containers on a dedicated network and publishes their
+	// ports on the loopback address of the host only.
+	NetworkBridge NetworkMode = "bridge"
+	// NetworkHost runs the containers in the host network namespace, listening on
+	// every interface of the host.
+	NetworkHost NetworkMode = "host"
+)
+
+// Ports the components listen on inside their containers in bridge mode.
+const (
+	etcdClientContainerPort    = 2379
+	etcdPeerContainerPort      = 2380
+	kubeAPIServerContainerPort = 6443
+)
+
+// ParseNetworkMode validates a network mode name.
+func ParseNetworkMode(s string) (NetworkMode, error) {
+	switch mode := NetworkMode(strings.ToLower(s)); mode {
+	case NetworkBridge, NetworkHost:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported network mode %q (expected bridge or host)", s)
+	}
+}
+
+// Network is how the containers of a session reach each other and the host.
+type Network struct {
+	// Mode is NetworkBridge or NetworkHost; empty means NetworkBridge.
+	Mode NetworkMode `json:"mode,omitempty"`
+	// Name is the dedicated network of bridge mode.
+	Name string `json:"name,omitempty"`
+}
+
+// DefaultNetwork returns the bridge network of the default session.
+func DefaultNetwork() Network {
+	return Network{Mode: NetworkBridge, Name: DefaultNetworkName}
+}
+
+// IsHost reports whether the containers use the host network.
+func (n Network) IsHost() bool {
+	return n.Mode == NetworkHost
+}
+
+// EtcdEndpoint returns the etcd client URL kube-apiserver connects to: the etcd
+// container name on the dedicated network, or the host port in host mode.
+func (n Network) EtcdEndpoint(etcdContainerName string, etcdTLS *EtcdTLS, ports Ports) string {
+	if n.IsHost() {
+		return fmt.Sprintf("%s://127.0.0.1:%d", etcdTLS.scheme(), ports.EtcdClient)
+	}
+	return fmt.Sprintf("%s://%s:%d", etcdTLS.scheme(), etcdContainerName, etcdClientContainerPort)
+}
+
+// KubeAPIServerURL returns the URL kube-apiserver is reachable at from the host:
+// the host IP in host mode, the published loopback port otherwise.
+func (n Network) KubeAPIServerURL(hostIP string, ports Ports) string {
+	if n.IsHost() {
+		return "https://" + net.JoinHostPort(hostIP, strconv.Itoa(ports.KubeAPIServer))
+	}
+	return ports.KubeAPIServerURL()
+}
+
+// apply sets the network of a container and, in bridge mode, publishes containerPort
+// on hostPort of the loopback address.
+func (n Network) apply(opts *container.RunOptions, hostPort, containerPort int) {
+	if n.IsHost() {
+		opts.Network = string(NetworkHost)
+		return
+	}
+	opts.Network = n.Name
+	opts.Publish = append(opts.Publish, fmt.Sprintf("%s:%d:%d", DefaultPublishAddress, hostPort, containerPort))
+}
+
+// ensureNetwork creates the dedicated network of bridge mode unless it already
+// exists, and reports whether it was created.
+func ensureNetwork(ctx context.Context, rt container.Runtime, network Network) (bool, error) {
+	if network.IsHost() || rt.NetworkExists(ctx, network.Name) {
+		return false, nil
+	}
+	fmt.Printf("Creating network: %s...\n", network.Name)
+	if err := rt.NetworkCreate(ctx, network.Name); err != nil {
+		return false, fmt.Errorf("failed to create network %s: %v", network.Name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,441 @@
+package etcd
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+// clientUser is a user kubeconfigs are generated for, with a client certificate and a
+// static token.
+type clientUser struct {
+	name              string
+	group             string
+	certFile, keyFile string
+}
+
+// adminUser is authorized for everything; viewerUser is restricted by the read-only policy.
+var (
+	adminUser  = clientUser{name: "kubernetes-admin", group: "system:masters", certFile: adminCertFile, keyFile: adminKeyFile}
+	viewerUser = clientUser{name: "snapshot-insight-viewer", group: ViewerGroup, certFile: viewerCertFile, keyFile: viewerKeyFile}
+)
+
+// certsMount is where the certificates volume is mounted in the etcd and kube-apiserver containers.
+const certsMount = "/certs"
+
+// Files of the certificates volume, relative to its root. The layout follows kubeadm's
+// /etc/kubernetes/pki.
+const (
+	caCertFile         = "ca.crt"
+	caKeyFile          = "ca.key"
+	apiServerCertFile  = "apiserver.crt"
+	apiServerKeyFile   = "apiserver.key"
+	saKeyFile          = "sa.key"
+	saPubFile          = "sa.pub"
+	adminCertFile      = "admin.crt"
+	adminKeyFile       = "admin.key"
+	viewerCertFile     = "viewer.crt"
+	viewerKeyFile      = "viewer.key"
+	etcdServerCertFile = "etcd/server.crt"
+	etcdServerKeyFile  = "etcd/server.key"
+	etcdPeerCertFile   = "etcd/peer.crt"
+	etcdPeerKeyFile    = "etcd/peer.key"
+	etcdClientCertFile = "apiserver-etcd-client.crt"
+	etcdClientKeyFile  = "apiserver-etcd-client.key"
+	tokenFile          = "tokens.csv"
+)
+
+// serviceClusterIPRange is the service network of kube-apiserver; kubernetesServiceIP is
+// the first address of it, used by the kubernetes.default service.
+const (
+	serviceClusterIPRange = "10.96.0.0/12"
+	kubernetesServiceIP   = "10.96.0.1"
+)
+
+// EtcdTLS locates the certificates etcd serves TLS with when client certificate
+// authentication is enabled.
+type EtcdTLS struct {
+	// CertsVolume holds the certificates for the containers.
+	CertsVolume string
+	// PKIDir holds the same certificates on the host, used for health checks.
+	PKIDir string
+}
+
+// scheme returns the scheme of the etcd client URLs, https when t is set.
+func (t *EtcdTLS) scheme() string {
+	if t == nil {
+		return "http"
+	}
+	return "https"
+}
+
+// clientConfig returns the TLS configuration the host connects to etcd with, using the
+// kube-apiserver etcd client certificate.
+func (t *EtcdTLS) clientConfig() (*tls.Config, error) {
+	return clientTLSConfig(t.PKIDir, etcdClientCertFile, etcdClientKeyFile)
+}
+
+// clientTLSConfig returns a TLS configuration that trusts the CA of the PKI in pkiDir and
+// authenticates with one of its client certificates.
+func clientTLSConfig(pkiDir, certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(pkiDir, certFile), filepath.Join(pkiDir, keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate %s: %v", certFile, err)
+	}
+	caPEM, err := os.ReadFile(filepath.Join(pkiDir, caCertFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("failed to decode CA certificate PEM")
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: roots}, nil
+}
+
+// PKIOptions customise the PKI of a session.
+type PKIOptions struct {
+	// EtcdHosts are the names etcd is reached by; no etcd certificates are generated when empty.
+	EtcdHosts []string
+	// CACert and CAKey are an existing CA, such as the source cluster's, that signs the
+	// generated certificates instead of a new self-signed one.
+	CACert string
+	CAKey  string
+	// SAKey is an existing service account signing key. SAPub holds the keys tokens are
+	// verified with and defaults to the public key of SAKey.
+	SAKey string
+	SAPub string
+	// Certs control the keys, lifetime and extra names of the generated certificates.
+	Certs CertOptions
+}
+
+// GeneratePKIInVolume generates the PKI of a session in pkiDir, see GeneratePKI, and copies
+// it into a new volume. When ctx is cancelled the volume is removed.
+func GeneratePKIInVolume(ctx context.Context, rt container.Runtime, volumeName, pkiDir, hostIP string, opts PKIOptions, images Images) (err error) {
+	rb := &rollback{rt: rt}
+	defer func() { rb.undoIfCancelled(ctx, err) }()
+
+	fmt.Printf("Generating certificates and keys in %s...\n", pkiDir)
+	if err := GeneratePKI(pkiDir, hostIP, opts); err != nil {
+		return err
+	}
+
+	// Create volume for certificates if it doesn't exist
+	fmt.Printf("Creating volume for certificates: %s...\n", volumeName)
+	if err := rt.VolumeCreate(ctx, volumeName); err != nil {
+		return fmt.Errorf("failed to create volume: %v", err)
+	}
+	rb.volume(volumeName)
+
+	// Copy certificates and keys into the volume
+	if err := EnsureImage(ctx, rt, images.Helper, images.PullPolicy); err != nil {
+		return fmt.Errorf("failed to prepare helper image: %v", err)
+	}
+	fmt.Printf("Copying certificates and keys into volume: %s...\n", volumeName)
+	_, err = rt.Run(ctx, container.RunOptions{
+		Image:  images.Helper,
+		Remove: true,
+		Volumes: []string{
+			fmt.Sprintf("%s:%s", volumeName, certsMount),
+			fmt.Sprintf("%s:/tmp/certs", pkiDir),
+		},
+		Command: []string{"sh", "-c", "cp -r /tmp/certs/. /certs/"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy certificates and keys into volume: %v", err)
+	}
+
+	fmt.Println("Certificates and keys successfully stored in volume.")
+	return nil
+}
+
+// GeneratePKI creates a kubeadm style PKI in dir: a self-signed CA, the kube-apiserver serving
+// certificate for hostIP, the loopback address and the in-cluster service names, a separate
+// service account key pair, and client certificates and static tokens for an admin in the
+// system:masters group and a viewer restricted by the read-only policy. When
+// etcdHosts is not empty it also creates the etcd serving and peer certificates for those names
+// and the kube-apiserver etcd client certificate, all signed by the same CA.
+//
+// The CA and the service account keys of the source cluster are copied instead of generated
+// when set in opts, so that its client certificates and service account tokens stay valid.
+func GeneratePKI(dir, hostIP string, opts PKIOptions) error {
+	if err := os.MkdirAll(filepath.Join(dir, "etcd"), 0o700); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %v", err)
+	}
+
+	var caCert *x509.Certificate
+	var caKey crypto.Signer
+	var err error
+	importedCA := opts.CACert != "" || opts.CAKey != ""
+	if importedCA {
+		if opts.Certs.Validity <= 0 {
+			opts.Certs.Validity = ImportedCACertValidity
+		}
+		fmt.Printf("Importing CA from %s...\n", opts.CACert)
+		caCert, caKey, err = importCA(opts.CACert, opts.CAKey, filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile))
+	} else {
+		caCert, caKey, err = generateCA(filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile), opts.Certs)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The serving certificate covers every name kubectl and in-cluster clients may use
+	serving := newCertificateTemplate("kube-apiserver", nil, x509.ExtKeyUsageServerAuth)
+	serving.DNSNames = []string{"localhost", "kubernetes", "kubernetes.default", "kubernetes.default.svc", "kubernetes.default.svc.cluster.local"}
+	serving.IPAddresses = []net.IP{net.ParseIP(DefaultPublishAddress), net.ParseIP(kubernetesServiceIP)}
+	if ip := net.ParseIP(hostIP); ip != nil {
+		serving.IPAddresses = append(serving.IPAddresses, ip)
+	}
+	serving.DNSNames = append(serving.DNSNames, opts.Certs.DNSNames...)
+	serving.IPAddresses = append(serving.IPAddresses, opts.Certs.IPAddresses...)
+	if err := issueCertificate(serving, caCert, caKey, filepath.Join(dir, apiServerCertFile), filepath.Join(dir, apiServerKeyFile), opts.Certs); err != nil {
+		return fmt.Errorf("failed to create kube-apiserver serving certificate: %v", err)
+	}
+
+	if opts.SAKey != "" {
+		fmt.Printf("Importing service account key from %s...\n", opts.SAKey)
+		err = importServiceAccountKey(opts.SAKey, opts.SAPub, filepath.Join(dir, saKeyFile), filepath.Join(dir, saPubFile))
+	} else if opts.SAPub != "" {
+		err = fmt.Errorf("a service account public key needs its signing key")
+	} else {
+		err = generateServiceAccountKey(filepath.Join(dir, saKeyFile), filepath.Join(dir, saPubFile), opts.Certs.keyAlgorithm())
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, user := range []clientUser{adminUser, viewerUser} {
+		template := newCertificateTemplate(user.name, []string{user.group}, x509.ExtKeyUsageClientAuth)
+		if err := issueCertificate(template, caCert, caKey, filepath.Join(dir, user.certFile), filepath.Join(dir, user.keyFile), opts.Certs); err != nil {
+			return fmt.Errorf("failed to create %s client certificate: %v", user.name, err)
+		}
+	}
+
+	if err := generateTokens(filepath.Join(dir, tokenFile), adminUser, viewerUser); err != nil {
+		return err
+	}
+
+	if len(opts.EtcdHosts) > 0 {
+		if err := generateEtcdCerts(dir, hostIP, opts.EtcdHosts, caCert, caKey, opts.Certs); err != nil {
+			return fmt.Errorf("failed to generate etcd certificates: %v", err)
+		}
+	}
+
+	fmt.Printf("Certificates generated successfully:\n- CA Cert: %s\n- Serving Cert: %s\n- Admin Cert: %s\n",
+		filepath.Join(dir, caCertFile), filepath.Join(dir, apiServerCertFile), filepath.Join(dir, adminCertFile))
+	if importedCA {
+		fmt.Printf("Warning: the certificates are signed by the imported CA and the source cluster accepts them as well: "+
+			"%s authenticates as system:masters and the etcd client certificate may reach etcd of the source cluster. "+
+			"They are valid for %s; keep %s private and delete it when done.\n", adminCertFile, opts.Certs.validity(), dir)
+	}
+	return nil
+}
+
+// generateCA creates a self-signed CA certificate and private key.
+func generateCA(certPath, keyPath string, opts CertOptions) (*x509.Certificate, crypto.Signer, error) {
+	key, err := generateKey(opts.keyAlgorithm())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA private key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"Kubernetes"},
+			CommonName:   "kubernetes",
+		},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if err := opts.stamp(template); err != nil {
+		return nil, nil, err
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	if err := writePEMFile(certPath, "CERTIFICATE", certDER); err != nil {
+		return nil, nil, fmt.Errorf("failed to write CA certificate: %v", err)
+	}
+	if err := writePrivateKey(keyPath, key); err != nil {
+		return nil, nil, fmt.Errorf("failed to write CA private key: %v", err)
+	}
+	return cert, key, nil
+}
+
+// generateServiceAccountKey creates the key pair service account tokens are signed and
+// verified with. kube-apiserver signs tokens with RSA and ECDSA keys only, so Ed25519
+// falls back to ECDSA P-256.
+func generateServiceAccountKey(keyPath, pubPath string, algorithm KeyAlgorithm) error {
+	if algorithm == KeyEd25519 {
+		algorithm = KeyECDSAP256
+	}
+	key, err := generateKey(algorithm)
+	if err != nil {
+		return fmt.Errorf("failed to generate service account key: %v", err)
+	}
+
+	if err := writePrivateKey(keyPath, key); err != nil {
+		return fmt.Errorf("failed to write service account key: %v", err)
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return fmt.Errorf("failed to marshal service account public key: %v", err)
+	}
+	if err := writePEMFile(pubPath, "PUBLIC KEY", pubBytes); err != nil {
+		return fmt.Errorf("failed to write service account public key: %v", err)
+	}
+	return nil
+}
+
+// generateTokens writes a kube-apiserver static token file with a random bearer token
+// for each user.
+func generateTokens(path string, users ...clientUser) error {
+	var lines strings.Builder
+	for _, user := range users {
+		token := make([]byte, 32)
+		if _, err := rand.Read(token); err != nil {
+			return fmt.Errorf("failed to generate token: %v", err)
+		}
+		fmt.Fprintf(&lines, "%s,%s,%s,\"%s\"\n", hex.EncodeToString(token), user.name, user.name, user.group)
+	}
+	if err := os.WriteFile(path, []byte(lines.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to write tokens: %v", err)
+	}
+	return nil
+}
+
+// readToken returns the token of a user from the static token file written by generateTokens.
+func readToken(path string, user clientUser) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) >= 2 && fields[1] == user.name && fields[0] != "" {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no token for %s in %s", user.name, path)
+}
+
+// newCertificateTemplate returns the template of a leaf certificate. The serial number and
+// validity are set when it is issued.
+func newCertificateTemplate(commonName string, organization []string, extKeyUsage ...x509.ExtKeyUsage) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName, Organization: organization},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: extKeyUsage,
+	}
+}
+
+// generateEtcdCerts creates the etcd serving and peer certificates for hosts and the
+// kube-apiserver etcd client certificate, signed by the CA.
+func generateEtcdCerts(dir, hostIP string, hosts []string, caCert *x509.Certificate, caKey crypto.Signer, opts CertOptions) error {
+	dnsNames := append([]string{"localhost"}, hosts...)
+	ips := []net.IP{net.ParseIP(DefaultPublishAddress)}
+	if ip := net.ParseIP(hostIP); ip != nil {
+		ips = append(ips, ip)
+	}
+
+	for _, c := range []struct {
+		certFile, keyFile string
+		template          *x509.Certificate
+	}{
+		{etcdServerCertFile, etcdServerKeyFile, newCertificateTemplate("etcd-server", nil, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth)},
+		{etcdPeerCertFile, etcdPeerKeyFile, newCertificateTemplate("etcd-peer", nil, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth)},
+		{etcdClientCertFile, etcdClientKeyFile, newCertificateTemplate("kube-apiserver-etcd-client", []string{"system:masters"}, x509.ExtKeyUsageClientAuth)},
+	} {
+		if c.certFile != etcdClientCertFile {
+			c.template.DNSNames = dnsNames
+			c.template.IPAddresses = ips
+		}
+		if err := issueCertificate(c.template, caCert, caKey, filepath.Join(dir, c.certFile), filepath.Join(dir, c.keyFile), opts); err != nil {
+			return fmt.Errorf("failed to create %s certificate: %v", c.template.Subject.CommonName, err)
+		}
+	}
+	return nil
+}
+
+// loadCA reads a PEM encoded CA certificate and its private key.
+func loadCA(caCertPath, caKeyPath string) (*x509.Certificate, crypto.Signer, error) {
+	// Read CA certificate
+	caCertPEM, err := os.ReadFile(caCertPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+
+	// Parse CA certificate
+	caCertBlock, _ := pem.Decode(caCertPEM)
+	if caCertBlock == nil {
+		return nil, nil, fmt.Errorf("failed to decode CA certificate PEM")
+	}
+	caCert, err := x509.ParseCertificate(caCertBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	// Read CA private key
+	caKey, err := readPrivateKey(caKeyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA private key: %v", err)
+	}
+	if pub, ok := caCert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(caKey.Public()) {
+		return nil, nil, fmt.Errorf("CA private key %s does not match certificate %s", caKeyPath, caCertPath)
+	}
+	return caCert, caKey, nil
+}
+
+// issueCertificate generates a key pair of the configured algorithm, signs template with
+// the CA and writes the certificate and private key.
+func issueCertificate(template, caCert *x509.Certificate, caKey crypto.Signer, certPath, keyPath string, opts CertOptions) error {
+	key, err := generateKey(opts.keyAlgorithm())
+	if err != nil {
+		return fmt.Errorf("failed to generate private key: %v", err)
+	}
+	if err := opts.stamp(template); err != nil {
+		return err
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	if err != nil {
+		return err
+	}
+	if err := writePEMFile(certPath, "CERTIFICATE", certDER); err != nil {
+		return fmt.Errorf("failed to write certificate: %v", err)
+	}
+	if err := writePrivateKey(keyPath, key); err != nil {
+		return fmt.Errorf("failed to write private key: %v", err)
+	}
+	return nil
+}
+
+// writePEMFile writes data to a PEM file readable by the owner only.
+func writePEMFile(path, blockType string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return pem.Encode(file, &pem.Block{Type: blockType, Bytes: data})
+}
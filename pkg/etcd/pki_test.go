@@ -0,0 +1,214 @@
+package etcd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+func TestGeneratePKIInVolume(t *testing.T) {
+	pkiDir := t.TempDir()
+	rt := container.NewFake()
+
+	if err := GeneratePKIInVolume(context.Background(), rt, "certs", pkiDir, "192.0.2.10", PKIOptions{EtcdHosts: []string{"etcd"}}, testImages); err != nil {
+		t.Fatalf("GeneratePKIInVolume: %v", err)
+	}
+
+	want := []string{
+		"volume-create certs",
+		"pull helper:test",
+		"run --rm -v certs:/certs -v " + pkiDir + ":/tmp/certs helper:test sh -c cp -r /tmp/certs/. /certs/",
+	}
+	if !reflect.DeepEqual(rt.Ops(), want) {
+		t.Errorf("ops mismatch\ngot:  %q\nwant: %q", rt.Ops(), want)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(readCert(t, filepath.Join(pkiDir, caCertFile)))
+	for _, tt := range []struct {
+		file  string
+		host  string
+		usage x509.ExtKeyUsage
+	}{
+		{file: etcdServerCertFile, host: "etcd", usage: x509.ExtKeyUsageServerAuth},
+		{file: etcdServerCertFile, host: "127.0.0.1", usage: x509.ExtKeyUsageServerAuth},
+		{file: etcdPeerCertFile, host: "192.0.2.10", usage: x509.ExtKeyUsageServerAuth},
+		{file: etcdClientCertFile, usage: x509.ExtKeyUsageClientAuth},
+	} {
+		cert := readCert(t, filepath.Join(pkiDir, tt.file))
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: tt.host, Roots: roots, KeyUsages: []x509.ExtKeyUsage{tt.usage}}); err != nil {
+			t.Errorf("%s does not verify for %q: %v", tt.file, tt.host, err)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(pkiDir, caKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("CA key permissions = %o, want 600", perm)
+	}
+}
+
+func TestGeneratePKI(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := GeneratePKI(dir, "192.0.2.10", PKIOptions{}); err != nil {
+		t.Fatalf("GeneratePKI: %v", err)
+	}
+
+	ca := readCert(t, filepath.Join(dir, caCertFile))
+	if !ca.IsCA || len(ca.IPAddresses) > 0 {
+		t.Errorf("expected a CA certificate without SANs, got IsCA=%v IPs=%v", ca.IsCA, ca.IPAddresses)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	serving := readCert(t, filepath.Join(dir, apiServerCertFile))
+	if serving.IsCA {
+		t.Errorf("serving certificate must not be a CA")
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "192.0.2.10", "10.96.0.1", "kubernetes.default.svc", "kubernetes.default.svc.cluster.local"} {
+		if _, err := serving.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("serving certificate does not verify for %s: %v", host, err)
+		}
+	}
+
+	admin := readCert(t, filepath.Join(dir, adminCertFile))
+	if _, err := admin.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("admin certificate does not verify as a client certificate: %v", err)
+	}
+	if admin.Subject.CommonName != "kubernetes-admin" || !reflect.DeepEqual(admin.Subject.Organization, []string{"system:masters"}) {
+		t.Errorf("admin subject = %v, want kubernetes-admin in system:masters", admin.Subject)
+	}
+
+	saPub, err := os.ReadFile(filepath.Join(dir, saPubFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(saPub)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		t.Fatalf("sa.pub is not a PEM public key: %s", saPub)
+	}
+	saKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse sa.pub: %v", err)
+	}
+	if reflect.DeepEqual(saKey, ca.PublicKey) || reflect.DeepEqual(saKey, serving.PublicKey) {
+		t.Errorf("service account key must be distinct from the CA and serving keys")
+	}
+}
+
+func TestGeneratePKIInVolumeWithoutEtcdTLS(t *testing.T) {
+	pkiDir := t.TempDir()
+
+	if err := GeneratePKIInVolume(context.Background(), container.NewFake(), "certs", pkiDir, "192.0.2.10", PKIOptions{}, testImages); err != nil {
+		t.Fatalf("GeneratePKIInVolume: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(pkiDir, etcdServerCertFile)); !os.IsNotExist(err) {
+		t.Errorf("expected no etcd certificates without etcd hosts")
+	}
+}
+
+func TestGeneratePKIInVolumeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		errors  map[string]error
+		wantErr string
+	}{
+		{
+			name:    "volume create failure",
+			errors:  map[string]error{"volume-create": errors.New("disk full")},
+			wantErr: "failed to create volume: disk full",
+		},
+		{
+			name:    "certificate copy failure",
+			errors:  map[string]error{"run": errors.New("image not found")},
+			wantErr: "failed to copy certificates and keys into volume: image not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := container.NewFake()
+			rt.Errors = tt.errors
+
+			err := GeneratePKIInVolume(context.Background(), rt, "certs", t.TempDir(), "192.0.2.10", PKIOptions{}, testImages)
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestStartWithEtcdTLS(t *testing.T) {
+	pkiDir := t.TempDir()
+	rt := container.NewFake()
+	if err := GeneratePKIInVolume(context.Background(), rt, "certs", pkiDir, "192.0.2.10", PKIOptions{EtcdHosts: []string{"etcd"}}, testImages); err != nil {
+		t.Fatalf("GeneratePKIInVolume: %v", err)
+	}
+	etcdTLS := &EtcdTLS{CertsVolume: "certs", PKIDir: pkiDir}
+	network := DefaultNetwork()
+
+	if err := StartEtcdServer(context.Background(), rt, "data", "etcd", "192.0.2.10", EtcdServerOptions{EtcdTLS: etcdTLS, Network: network, Ports: DefaultPorts(), Images: testImages}); err != nil {
+		t.Fatalf("StartEtcdServer: %v", err)
+	}
+	if err := StartKubeAPIServer(context.Background(), rt, network.EtcdEndpoint("etcd", etcdTLS, DefaultPorts()), "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{OutputDir: t.TempDir(), EtcdTLS: etcdTLS, Network: network, Ports: DefaultPorts(), Images: testImages}); err != nil {
+		t.Fatalf("StartKubeAPIServer: %v", err)
+	}
+
+	runs := rt.CallsFor("run")
+	etcdArgs, apiServerArgs := strings.Join(runs[1].Args, " "), strings.Join(runs[2].Args, " ")
+	for _, want := range []string{
+		"-v certs:/certs:ro",
+		"--advertise-client-urls=https://etcd:2379",
+		"--listen-client-urls=https://0.0.0.0:2379",
+		"--client-cert-auth --trusted-ca-file=/certs/ca.crt --cert-file=/certs/etcd/server.crt --key-file=/certs/etcd/server.key",
+		"--peer-client-cert-auth --peer-trusted-ca-file=/certs/ca.crt --peer-cert-file=/certs/etcd/peer.crt --peer-key-file=/certs/etcd/peer.key",
+	} {
+		if !strings.Contains(etcdArgs, want) {
+			t.Errorf("etcd args missing %s: %s", want, etcdArgs)
+		}
+	}
+	for _, want := range []string{
+		"--etcd-servers=https://etcd:2379",
+		"--etcd-cafile=/certs/ca.crt --etcd-certfile=/certs/apiserver-etcd-client.crt --etcd-keyfile=/certs/apiserver-etcd-client.key",
+	} {
+		if !strings.Contains(apiServerArgs, want) {
+			t.Errorf("kube-apiserver args missing %s: %s", want, apiServerArgs)
+		}
+	}
+
+	tlsConfig, err := etcdTLS.clientConfig()
+	if err != nil {
+		t.Fatalf("clientConfig: %v", err)
+	}
+	if len(tlsConfig.Certificates) != 1 || tlsConfig.RootCAs == nil {
+		t.Errorf("expected the etcd client certificate and the CA, got %+v", tlsConfig)
+	}
+}
+
+// readCert reads a PEM encoded certificate.
+func readCert(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s is not PEM encoded", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", path, err)
+	}
+	return cert
+}
@@ -0,0 +1,29 @@
+package etcd
+
+import "fmt"
+
+// Ports are the host ports etcd and kube-apiserver listen on.
+type Ports struct {
+	EtcdClient    int `json:"etcdClient"`
+	EtcdPeer      int `json:"etcdPeer"`
+	KubeAPIServer int `json:"kubeAPIServer"`
+}
+
+// DefaultPorts returns the standard etcd and kube-apiserver ports.
+func DefaultPorts() Ports {
+	return Ports{EtcdClient: DefaultEtcdClientPort, EtcdPeer: DefaultEtcdPeerPort, KubeAPIServer: DefaultKubeAPIServerPort}
+}
+
+// EtcdEndpoint returns the etcd client URL on the host, https when etcd serves TLS.
+func (p Ports) EtcdEndpoint(tls bool) string {
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://127.0.0.1:%d", scheme, p.EtcdClient)
+}
+
+// KubeAPIServerURL returns the kube-apiserver URL on the host.
+func (p Ports) KubeAPIServerURL() string {
+	return fmt.Sprintf("https://127.0.0.1:%d", p.KubeAPIServer)
+}
@@ -0,0 +1,67 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// readOnlyPolicyMount is where the read-only ABAC policy is mounted in the kube-apiserver container.
+const readOnlyPolicyMount = "/etc/kubernetes/read-only-policy.jsonl"
+
+// ViewerGroup is the group of the viewer credentials issued for read-only sessions. Unlike
+// system:masters, which kube-apiserver always authorizes, it is subject to the read-only policy.
+const ViewerGroup = "snapshot-insight:viewers"
+
+// abacPolicy is a line of an ABAC policy file.
+type abacPolicy struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Spec       abacPolicySpec `json:"spec"`
+}
+
+// abacPolicySpec grants a user or group access to resources or non-resource paths.
+type abacPolicySpec struct {
+	User            string `json:"user,omitempty"`
+	Group           string `json:"group,omitempty"`
+	Namespace       string `json:"namespace,omitempty"`
+	Resource        string `json:"resource,omitempty"`
+	APIGroup        string `json:"apiGroup,omitempty"`
+	NonResourcePath string `json:"nonResourcePath,omitempty"`
+	Readonly        bool   `json:"readonly"`
+}
+
+// readOnlyPolicy grants every authenticated user read access to all resources and paths,
+// and anonymous health checks. Requests with any other verb are denied.
+func readOnlyPolicy() []abacPolicySpec {
+	return []abacPolicySpec{
+		{Group: "system:authenticated", Namespace: "*", Resource: "*", APIGroup: "*", Readonly: true},
+		{Group: "system:authenticated", NonResourcePath: "*", Readonly: true},
+		{Group: "system:unauthenticated", NonResourcePath: "/readyz*", Readonly: true},
+		{Group: "system:unauthenticated", NonResourcePath: "/livez*", Readonly: true},
+		{Group: "system:unauthenticated", NonResourcePath: "/healthz*", Readonly: true},
+		{Group: "system:unauthenticated", NonResourcePath: "/version", Readonly: true},
+	}
+}
+
+// writeReadOnlyPolicy writes the read-only ABAC policy to outputDir and returns its absolute path.
+func writeReadOnlyPolicy(outputDir string) (string, error) {
+	var data []byte
+	for _, spec := range readOnlyPolicy() {
+		line, err := json.Marshal(abacPolicy{APIVersion: "abac.authorization.kubernetes.io/v1beta1", Kind: "Policy", Spec: spec})
+		if err != nil {
+			return "", fmt.Errorf("failed to encode read-only policy: %v", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	path, err := filepath.Abs(filepath.Join(outputDir, "read-only-policy.jsonl"))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve read-only policy path: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write read-only policy: %v", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,97 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+func TestStartKubeAPIServerReadOnly(t *testing.T) {
+	rt := container.NewFake()
+	dir := t.TempDir()
+
+	if err := StartKubeAPIServer(context.Background(), rt, "http://127.0.0.1:2379", "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{ReadOnly: true, OutputDir: dir, Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages}); err != nil {
+		t.Fatalf("StartKubeAPIServer: %v", err)
+	}
+
+	args := strings.Join(rt.CallsFor("run")[0].Args, " ")
+	policyPath := filepath.Join(dir, "read-only-policy.jsonl")
+	for _, want := range []string{
+		"-v " + policyPath + ":/etc/kubernetes/read-only-policy.jsonl:ro",
+		"--authorization-mode=ABAC --authorization-policy-file=/etc/kubernetes/read-only-policy.jsonl",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("kube-apiserver args missing %s: %s", want, args)
+		}
+	}
+
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		t.Fatalf("expected a read-only policy: %v", err)
+	}
+	if info, err := os.Stat(policyPath); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected a policy readable by the owner only, got %v, %v", info.Mode(), err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(readOnlyPolicy()) {
+		t.Fatalf("expected %d policies, got %d", len(readOnlyPolicy()), len(lines))
+	}
+	for i, line := range lines {
+		policy := abacPolicy{}
+		if err := json.Unmarshal([]byte(line), &policy); err != nil {
+			t.Fatalf("policy %d is not JSON: %v", i, err)
+		}
+		if policy.Kind != "Policy" || policy.APIVersion != "abac.authorization.kubernetes.io/v1beta1" {
+			t.Errorf("policy %d has type %s/%s", i, policy.APIVersion, policy.Kind)
+		}
+		if !policy.Spec.Readonly {
+			t.Errorf("policy %d grants write access: %s", i, line)
+		}
+		if policy.Spec.Group != "system:authenticated" && !strings.HasPrefix(policy.Spec.NonResourcePath, "/") {
+			t.Errorf("policy %d grants anonymous access beyond health checks: %s", i, line)
+		}
+	}
+}
+
+func TestStartKubeAPIServerReadWrite(t *testing.T) {
+	rt := container.NewFake()
+	dir := t.TempDir()
+
+	if err := StartKubeAPIServer(context.Background(), rt, "http://127.0.0.1:2379", "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{OutputDir: dir, Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages}); err != nil {
+		t.Fatalf("StartKubeAPIServer: %v", err)
+	}
+	if args := strings.Join(rt.CallsFor("run")[0].Args, " "); strings.Contains(args, "--authorization-mode") {
+		t.Errorf("expected the default authorization without --read-only: %s", args)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "read-only-policy.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("expected no read-only policy without --read-only")
+	}
+}
+
+func TestViewerCredentials(t *testing.T) {
+	dir := t.TempDir()
+	if err := GeneratePKI(dir, "192.0.2.10", PKIOptions{}); err != nil {
+		t.Fatalf("GeneratePKI: %v", err)
+	}
+
+	viewer := readCert(t, filepath.Join(dir, viewerCertFile))
+	if viewer.Subject.CommonName != viewerUser.name || !reflect.DeepEqual(viewer.Subject.Organization, []string{ViewerGroup}) {
+		t.Errorf("viewer subject = %v, want %s in %s", viewer.Subject, viewerUser.name, ViewerGroup)
+	}
+
+	tokens, err := os.ReadFile(filepath.Join(dir, tokenFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`,kubernetes-admin,kubernetes-admin,"system:masters"`, `,snapshot-insight-viewer,snapshot-insight-viewer,"snapshot-insight:viewers"`} {
+		if !strings.Contains(string(tokens), want) {
+			t.Errorf("token file missing %s:\n%s", want, tokens)
+		}
+	}
+}
@@ -1,65 +1,87 @@
 package etcd
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot"
 )
 
-// RestoreEtcdSnapshot restores an etcd snapshot using etcdutl directly within a Docker container.
-func RestoreEtcdSnapshot(snapshotPath, containerName, volumeName string) error {
+// RestoreEtcdSnapshot restores an etcd snapshot using etcdutl directly within a container.
+// When ctx is cancelled the restore container and the new volume are removed.
+func RestoreEtcdSnapshot(ctx context.Context, rt container.Runtime, snapshotPath, containerName, volumeName string, images Images) (err error) {
+	rb := &rollback{rt: rt}
+	defer func() { rb.undoIfCancelled(ctx, err) }()
+
 	// Validate snapshot existence
 	if _, err := os.Stat(snapshotPath); os.IsNotExist(err) {
 		return fmt.Errorf("snapshot file not found: %s", snapshotPath)
 	}
 
-	// Pull etcd Docker image
-	fmt.Println("Pulling etcd Docker image...")
-	cmdPull := exec.Command("docker", "pull", "quay.io/coreos/etcd:v3.5.7")
-	cmdPull.Stdout = os.Stdout
-	cmdPull.Stderr = os.Stderr
-	if err := cmdPull.Run(); err != nil {
-		return fmt.Errorf("failed to pull etcd Docker image: %v", err)
+	// Unwrap compressed or archived snapshots into a plain database file
+	prepared, err := snapshot.Prepare(snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer prepared.Close()
+	for _, step := range prepared.Steps {
+		fmt.Printf("Snapshot input: %s\n", step)
+	}
+
+	// Verify the snapshot up front rather than failing late inside the container
+	fmt.Println("Verifying snapshot...")
+	report, err := snapshot.Verify(prepared.Path)
+	if err != nil {
+		return fmt.Errorf("snapshot verification failed: %v", err)
+	}
+	report.Path = snapshotPath
+	fmt.Print(report)
+
+	// Make the etcd image available according to the pull policy
+	if err := EnsureImage(ctx, rt, images.Etcd, images.PullPolicy); err != nil {
+		return fmt.Errorf("failed to prepare etcd image: %v", err)
 	}
 
 	// Remove existing container if it exists
 	fmt.Printf("Removing existing container: %s (if running)...\n", containerName)
-	cmdRemove := exec.Command("docker", "rm", "-f", containerName)
-	cmdRemove.Stdout = os.Stdout
-	cmdRemove.Stderr = os.Stderr
-	_ = cmdRemove.Run() // Ignore errors if the container doesn't exist
+	_ = rt.Remove(ctx, containerName) // Ignore errors if the container doesn't exist
 
-	// Remove existing Docker volume if it exists
-	fmt.Printf("Removing existing Docker volume: %s (if exists)...\n", volumeName)
-	cmdVolumeRemove := exec.Command("docker", "volume", "rm", volumeName)
-	cmdVolumeRemove.Stdout = os.Stdout
-	cmdVolumeRemove.Stderr = os.Stderr
-	_ = cmdVolumeRemove.Run() // Ignore errors if the volume doesn't exist
+	// Remove existing volume if it exists
+	fmt.Printf("Removing existing volume: %s (if exists)...\n", volumeName)
+	_ = rt.VolumeRemove(ctx, volumeName) // Ignore errors if the volume doesn't exist
 
-	// Create a Docker volume for etcd data
-	fmt.Printf("Creating Docker volume: %s...\n", volumeName)
-	cmdVolumeCreate := exec.Command("docker", "volume", "create", volumeName)
-	cmdVolumeCreate.Stdout = os.Stdout
-	cmdVolumeCreate.Stderr = os.Stderr
-	if err := cmdVolumeCreate.Run(); err != nil {
-		return fmt.Errorf("failed to create Docker volume: %v", err)
+	// Create a volume for etcd data
+	fmt.Printf("Creating volume: %s...\n", volumeName)
+	if err := rt.VolumeCreate(ctx, volumeName); err != nil {
+		return fmt.Errorf("failed to create volume: %v", err)
 	}
+	rb.volume(volumeName)
 
 	// Run the etcdutl snapshot restore command
-	fmt.Printf("Restoring snapshot: %s into Docker volume: %s...\n", snapshotPath, volumeName)
-	cmdRestore := exec.Command("docker", "run", "--rm", "--name", containerName,
-		"-v", fmt.Sprintf("%s:/snapshot.db", snapshotPath), // Mount snapshot file
-		"-v", fmt.Sprintf("%s:/etcd-data", volumeName), // Use Docker volume for output
-		"quay.io/coreos/etcd:v3.5.7",                    // Image
-		"/usr/local/bin/etcdutl", "snapshot", "restore", // Command
-		"/snapshot.db", "--data-dir=/etcd-data") // Args
-	cmdRestore.Stdout = os.Stdout
-	cmdRestore.Stderr = os.Stderr
-	if err := cmdRestore.Run(); err != nil {
+	fmt.Printf("Restoring snapshot: %s into volume: %s...\n", snapshotPath, volumeName)
+	restoreCmd := []string{"/usr/local/bin/etcdutl", "snapshot", "restore", "/snapshot.db", "--data-dir=/etcd-data"}
+	if !report.HasHash {
+		// etcdutl refuses databases copied from a member directory unless told there is no digest
+		restoreCmd = append(restoreCmd, "--skip-hash-check")
+	}
+	rb.container(containerName)
+	_, err = rt.Run(ctx, container.RunOptions{
+		Name:   containerName,
+		Image:  images.Etcd,
+		Remove: true,
+		Volumes: []string{
+			fmt.Sprintf("%s:/snapshot.db", prepared.Path), // Mount snapshot file
+			fmt.Sprintf("%s:/etcd-data", volumeName),      // Use volume for output
+		},
+		Command: restoreCmd,
+	})
+	if err != nil {
 		return fmt.Errorf("failed to restore snapshot: %v", err)
 	}
 
 	fmt.Println("Snapshot restored successfully.")
-	fmt.Printf("Restored data is available in Docker volume: %s\n", volumeName)
+	fmt.Printf("Restored data is available in volume: %s\n", volumeName)
 	return nil
 }
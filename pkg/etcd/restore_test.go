@@ -0,0 +1,173 @@
+package etcd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot/snapshottest"
+)
+
+// testImages pulls unconditionally so every test records its pulls.
+var testImages = Images{Etcd: "etcd:test", KubeAPIServer: "apiserver:test", Helper: "helper:test", PullPolicy: PullAlways}
+
+func TestRestoreEtcdSnapshot(t *testing.T) {
+	snapshotPath := snapshottest.Write(t, snapshottest.Put("/registry/namespaces/default", []byte("{}")))
+	snapshottest.AppendHash(t, snapshotPath)
+
+	tests := []struct {
+		name    string
+		errors  map[string]error
+		wantErr string
+		wantOps []string
+	}{
+		{
+			name: "success",
+			wantOps: []string{
+				"pull etcd:test",
+				"rm restore",
+				"volume-rm data",
+				"volume-create data",
+				"run --rm --name restore -v " + snapshotPath + ":/snapshot.db -v data:/etcd-data etcd:test " +
+					"/usr/local/bin/etcdutl snapshot restore /snapshot.db --data-dir=/etcd-data",
+			},
+		},
+		{
+			name:    "pull failure stops before touching volumes",
+			errors:  map[string]error{"pull": errors.New("registry unreachable")},
+			wantErr: "failed to prepare etcd image: failed to pull image etcd:test",
+			wantOps: []string{"pull etcd:test"},
+		},
+		{
+			name: "missing container and volume are ignored",
+			errors: map[string]error{
+				"rm":        errors.New("no such container"),
+				"volume-rm": errors.New("no such volume"),
+			},
+			wantOps: []string{
+				"pull etcd:test",
+				"rm restore",
+				"volume-rm data",
+				"volume-create data",
+				"run --rm --name restore -v " + snapshotPath + ":/snapshot.db -v data:/etcd-data etcd:test " +
+					"/usr/local/bin/etcdutl snapshot restore /snapshot.db --data-dir=/etcd-data",
+			},
+		},
+		{
+			name:    "volume create failure",
+			errors:  map[string]error{"volume-create": errors.New("disk full")},
+			wantErr: "failed to create volume",
+			wantOps: []string{"pull etcd:test", "rm restore", "volume-rm data", "volume-create data"},
+		},
+		{
+			name:    "restore failure",
+			errors:  map[string]error{"run": errors.New("exit status 1")},
+			wantErr: "failed to restore snapshot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := container.NewFake()
+			rt.Errors = tt.errors
+
+			err := RestoreEtcdSnapshot(context.Background(), rt, snapshotPath, "restore", "data", testImages)
+			checkErr(t, err, tt.wantErr)
+			if tt.wantOps != nil && !reflect.DeepEqual(rt.Ops(), tt.wantOps) {
+				t.Errorf("ops mismatch\ngot:  %q\nwant: %q", rt.Ops(), tt.wantOps)
+			}
+		})
+	}
+}
+
+func TestRestoreEtcdSnapshotWithoutHash(t *testing.T) {
+	snapshotPath := snapshottest.Write(t, snapshottest.Put("/registry/namespaces/default", []byte("{}")))
+	rt := container.NewFake()
+
+	if err := RestoreEtcdSnapshot(context.Background(), rt, snapshotPath, "restore", "data", testImages); err != nil {
+		t.Fatalf("RestoreEtcdSnapshot: %v", err)
+	}
+
+	runs := rt.CallsFor("run")
+	if len(runs) != 1 || runs[0].Args[len(runs[0].Args)-1] != "--skip-hash-check" {
+		t.Errorf("expected restore with --skip-hash-check, got %q", rt.Ops())
+	}
+}
+
+func TestRestoreEtcdSnapshotCompressed(t *testing.T) {
+	db, err := os.ReadFile(snapshottest.Write(t, snapshottest.Put("/registry/namespaces/default", []byte("{}"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.db.gz")
+	if err := os.WriteFile(snapshotPath, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rt := container.NewFake()
+
+	if err := RestoreEtcdSnapshot(context.Background(), rt, snapshotPath, "restore", "data", testImages); err != nil {
+		t.Fatalf("RestoreEtcdSnapshot: %v", err)
+	}
+
+	runs := rt.CallsFor("run")
+	if len(runs) != 1 {
+		t.Fatalf("expected one restore run, got %q", rt.Ops())
+	}
+	mount := runs[0].Args[4]
+	if strings.HasPrefix(mount, snapshotPath) || !strings.HasSuffix(mount, ":/snapshot.db") {
+		t.Errorf("expected the decompressed database to be mounted, got %s", mount)
+	}
+}
+
+func TestRestoreEtcdSnapshotCorrupt(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.db")
+	if err := os.WriteFile(snapshotPath, []byte("truncated upload"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rt := container.NewFake()
+
+	err := RestoreEtcdSnapshot(context.Background(), rt, snapshotPath, "restore", "data", testImages)
+	checkErr(t, err, "snapshot verification failed")
+	if len(rt.Calls) != 0 {
+		t.Errorf("expected no runtime calls, got %q", rt.Ops())
+	}
+}
+
+func TestRestoreEtcdSnapshotMissingFile(t *testing.T) {
+	rt := container.NewFake()
+
+	err := RestoreEtcdSnapshot(context.Background(), rt, filepath.Join(t.TempDir(), "missing.db"), "restore", "data", testImages)
+	checkErr(t, err, "snapshot file not found")
+	if len(rt.Calls) != 0 {
+		t.Errorf("expected no runtime calls, got %q", rt.Ops())
+	}
+}
+
+// checkErr fails the test unless err matches want; an empty want expects no error.
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+
+	switch {
+	case want == "" && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want != "" && err == nil:
+		t.Fatalf("expected error containing %q, got nil", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Fatalf("expected error containing %q, got %v", want, err)
+	}
+}
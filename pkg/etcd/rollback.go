@@ -0,0 +1,70 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+// rollbackTimeout bounds the removal of partially created resources after a cancellation.
+const rollbackTimeout = 30 * time.Second
+
+// rollback records the containers, networks and volumes created by an operation so that they
+// can be removed when the operation is cancelled part way through.
+type rollback struct {
+	rt         container.Runtime
+	containers []string
+	networks   []string
+	volumes    []string
+}
+
+// container records a container to remove on cancellation.
+func (r *rollback) container(name string) {
+	r.containers = append(r.containers, name)
+}
+
+// network records a network to remove on cancellation.
+func (r *rollback) network(name string) {
+	r.networks = append(r.networks, name)
+}
+
+// volume records a volume to remove on cancellation.
+func (r *rollback) volume(name string) {
+	r.volumes = append(r.volumes, name)
+}
+
+// undoIfCancelled removes the recorded containers, then networks, then volumes, when the operation
+// failed because ctx was cancelled. Removal uses a fresh context as ctx is done.
+func (r *rollback) undoIfCancelled(ctx context.Context, err error) {
+	if err == nil || ctx.Err() == nil || len(r.containers)+len(r.networks)+len(r.volumes) == 0 {
+		return
+	}
+
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	fmt.Println("Cancelled, rolling back partially created resources...")
+	for i := len(r.containers) - 1; i >= 0; i-- {
+		if err := r.rt.Remove(cleanupCtx, r.containers[i]); err != nil {
+			fmt.Printf("Failed to remove container %s: %v\n", r.containers[i], err)
+			continue
+		}
+		fmt.Printf("Removed container: %s\n", r.containers[i])
+	}
+	for i := len(r.networks) - 1; i >= 0; i-- {
+		if err := r.rt.NetworkRemove(cleanupCtx, r.networks[i]); err != nil {
+			fmt.Printf("Failed to remove network %s: %v\n", r.networks[i], err)
+			continue
+		}
+		fmt.Printf("Removed network: %s\n", r.networks[i])
+	}
+	for i := len(r.volumes) - 1; i >= 0; i-- {
+		if err := r.rt.VolumeRemove(cleanupCtx, r.volumes[i]); err != nil {
+			fmt.Printf("Failed to remove volume %s: %v\n", r.volumes[i], err)
+			continue
+		}
+		fmt.Printf("Removed volume: %s\n", r.volumes[i])
+	}
+}
@@ -0,0 +1,90 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot/snapshottest"
+)
+
+func TestRestoreEtcdSnapshotRollsBackOnCancel(t *testing.T) {
+	snapshotPath := snapshottest.Write(t, snapshottest.Put("/registry/namespaces/default", []byte("{}")))
+	snapshottest.AppendHash(t, snapshotPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt := container.NewFake()
+	rt.Hooks["run"] = cancel // Ctrl-C while etcdutl is restoring
+
+	err := RestoreEtcdSnapshot(ctx, rt, snapshotPath, "restore", "data", testImages)
+	checkErr(t, err, "context canceled")
+
+	ops := rt.Ops()
+	if got, want := ops[len(ops)-2:], []string{"rm restore", "volume-rm data"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rollback ops = %q, want %q", got, want)
+	}
+}
+
+func TestStartKubeAPIServerRollsBackOnCancel(t *testing.T) {
+	tests := []struct {
+		name         string
+		cancelOn     string
+		wantRollback []string
+	}{
+		{name: "while pulling", cancelOn: "pull"},
+		{name: "while starting", cancelOn: "run", wantRollback: []string{"rm apiserver", "network-rm snapshot-insight"}},
+		{name: "while waiting for readiness", cancelOn: "inspect", wantRollback: []string{"rm apiserver", "network-rm snapshot-insight"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubProbe(t, context.Canceled)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			rt := container.NewFake()
+			rt.Hooks[tt.cancelOn] = cancel
+
+			err := StartKubeAPIServer(ctx, rt, "http://127.0.0.1:2379", "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{OutputDir: t.TempDir(), Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages, ReadyTimeout: time.Minute})
+			checkErr(t, err, "context canceled")
+
+			ops := rt.Ops()
+			if got := ops[len(ops)-len(tt.wantRollback):]; len(tt.wantRollback) > 0 && !reflect.DeepEqual(got, tt.wantRollback) {
+				t.Errorf("rollback ops = %q, want %q", got, tt.wantRollback)
+			}
+			if len(tt.wantRollback) == 0 && len(rt.CallsFor("network-rm")) > 0 {
+				t.Errorf("expected nothing to roll back, got %q", ops)
+			}
+		})
+	}
+}
+
+func TestGeneratePKIInVolumeRollsBackOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt := container.NewFake()
+	rt.Hooks["run"] = cancel // Ctrl-C while copying the certificates
+
+	err := GeneratePKIInVolume(ctx, rt, "certs", t.TempDir(), "192.0.2.10", PKIOptions{}, testImages)
+	checkErr(t, err, "context canceled")
+
+	ops := rt.Ops()
+	if got := ops[len(ops)-1]; got != "volume-rm certs" {
+		t.Errorf("rollback op = %q, want volume-rm certs", got)
+	}
+}
+
+func TestNoRollbackOnFailure(t *testing.T) {
+	stubProbe(t, context.DeadlineExceeded)
+	rt := container.NewFake()
+	rt.InspectOutput = `[{"State": {"Running": false, "ExitCode": 2}}]`
+
+	// A container that failed on its own is kept for its logs
+	err := StartEtcdServer(context.Background(), rt, "data", "etcd", "192.0.2.10", EtcdServerOptions{Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages, ReadyTimeout: time.Minute})
+	checkErr(t, err, "etcd container etcd exited with code 2")
+	if removals := rt.CallsFor("rm"); len(removals) != 1 {
+		t.Errorf("expected only the initial removal, got %v", removals)
+	}
+}
@@ -2,329 +2,324 @@ package etcd
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/base64"
-	"encoding/pem"
+	"context"
+	"crypto/tls"
 	"fmt"
-	"math/big"
-	"net"
-	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
-	"text/template"
 	"time"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+	"github.com/supporttools/snapshot-insight/pkg/encryption"
 )
 
-// StartEtcdServer starts an etcd server using the specified Docker volume and host networking.
-func StartEtcdServer(volumeName, containerName string) (string, error) {
-	// Resolve the host's primary IP address
-	hostIP, err := getHostIPAddress()
-	if err != nil {
-		return "", fmt.Errorf("failed to resolve host IP address: %v", err)
-	}
+// encryptionConfigMount is where the encryption configuration is mounted in the kube-apiserver container.
+const encryptionConfigMount = "/etc/kubernetes/encryption-config.json"
+
+// EtcdServerOptions customise the etcd server started on the restored data.
+type EtcdServerOptions struct {
+	// EtcdTLS, when set, makes etcd serve TLS and require client certificates signed
+	// by the session CA.
+	EtcdTLS *EtcdTLS
+	// Network and Ports are those of the session; the etcd client port is published on
+	// the loopback address in bridge mode.
+	Network Network
+	Ports   Ports
+	Images  Images
+	// ReadyTimeout, when positive, is how long to wait for etcd to report healthy.
+	ReadyTimeout time.Duration
+}
 
-	// Build the advertise-client-urls value
-	advertiseURLs := fmt.Sprintf("http://127.0.0.1:2379,http://%s:2379", hostIP)
+// StartEtcdServer starts an etcd server using the specified volume. In bridge mode it
+// runs on the dedicated network of opts.Network with its client port published on the
+// loopback address; in host mode it uses host networking and listens on the etcd ports
+// of opts.Ports, advertising hostIP. When ctx is cancelled the etcd container, and the
+// network if it was created, are removed.
+func StartEtcdServer(ctx context.Context, rt container.Runtime, volumeName, containerName, hostIP string, opts EtcdServerOptions) (err error) {
+	rb := &rollback{rt: rt}
+	defer func() { rb.undoIfCancelled(ctx, err) }()
 
 	// Remove existing container if it exists
 	fmt.Printf("Removing existing etcd container: %s (if running)...\n", containerName)
-	cmdRemove := exec.Command("docker", "rm", "-f", containerName)
-	cmdRemove.Stdout = os.Stdout
-	cmdRemove.Stderr = os.Stderr
-	_ = cmdRemove.Run() // Ignore errors if the container doesn't exist
-
-	// Log the details of the action being performed
-	fmt.Printf("Starting etcd server using Docker volume: %s...\n", volumeName)
-
-	// Build the command
-	cmdRun := exec.Command("docker", "run", "-d", "--name", containerName,
-		"--network", "host", // Use host network mode
-		"-v", fmt.Sprintf("%s:/etcd-data", volumeName), // Use Docker volume
-		"quay.io/coreos/etcd:v3.5.7", // Image
-		"/usr/local/bin/etcd", "--name=restored-etcd",
-		"--data-dir=/etcd-data",
-		"--advertise-client-urls="+advertiseURLs,
-		"--listen-client-urls=http://0.0.0.0:2379",
-		"--listen-peer-urls=http://0.0.0.0:2380")
-
-	// Log the full command for debugging
-	fmt.Printf("Executing command: %s\n", strings.Join(cmdRun.Args, " "))
+	_ = rt.Remove(ctx, containerName) // Ignore errors if the container doesn't exist
 
-	// Capture and log the output of the command
-	output, err := cmdRun.CombinedOutput()
-	fmt.Printf("Command output:\n%s\n", string(output))
-	if err != nil {
-		return "", fmt.Errorf("failed to start etcd server: %v", err)
+	// Make the etcd image available according to the pull policy
+	if err := EnsureImage(ctx, rt, opts.Images.Etcd, opts.Images.PullPolicy); err != nil {
+		return fmt.Errorf("failed to prepare etcd image: %v", err)
 	}
 
-	fmt.Println("Etcd server started successfully and is listening on host ports.")
-	return hostIP, nil
-}
-
-// StartKubeAPIServer starts a kube-apiserver using the specified etcd endpoint and Docker volume for certificates.
-func StartKubeAPIServer(etcdEndpoint, containerName, volumeName, hostIP, outputDir string) error {
-	// Remove existing kube-apiserver container if it exists
-	fmt.Printf("Removing existing kube-apiserver container: %s (if running)...\n", containerName)
-	cmdRemove := exec.Command("docker", "rm", "-f", containerName)
-	cmdRemove.Stdout = os.Stdout
-	cmdRemove.Stderr = os.Stderr
-	_ = cmdRemove.Run() // Ignore errors if the container doesn't exist
-
-	if etcdEndpoint == "" {
-		return fmt.Errorf("etcd endpoint is required to start kube-apiserver")
+	// Create the dedicated network of bridge mode
+	created, err := ensureNetwork(ctx, rt, opts.Network)
+	if err != nil {
+		return err
 	}
-
-	// Create Docker volume for certificates if it doesn't exist
-	fmt.Printf("Creating Docker volume for certificates: %s...\n", volumeName)
-	cmdVolumeCreate := exec.Command("docker", "volume", "create", volumeName)
-	cmdVolumeCreate.Stdout = os.Stdout
-	cmdVolumeCreate.Stderr = os.Stderr
-	if err := cmdVolumeCreate.Run(); err != nil {
-		return fmt.Errorf("failed to create Docker volume: %v", err)
+	if created {
+		rb.network(opts.Network.Name)
 	}
 
-	// Paths inside the Docker volume
-	volumeCertDir := "/certs"
-	caCertPath := filepath.Join(volumeCertDir, "ca.crt")
-	caKeyPath := filepath.Join(volumeCertDir, "ca.key")
+	// Log the details of the action being performed
+	fmt.Printf("Starting etcd server using volume: %s...\n", volumeName)
+
+	// Build the container definition
+	scheme := opts.EtcdTLS.scheme()
+	command := []string{"/usr/local/bin/etcd", "--name=restored-etcd", "--data-dir=/etcd-data"}
+	if opts.Network.IsHost() {
+		command = append(command,
+			fmt.Sprintf("--advertise-client-urls=%s://127.0.0.1:%d,%s://%s:%d", scheme, opts.Ports.EtcdClient, scheme, hostIP, opts.Ports.EtcdClient),
+			fmt.Sprintf("--listen-client-urls=%s://0.0.0.0:%d", scheme, opts.Ports.EtcdClient),
+			fmt.Sprintf("--listen-peer-urls=%s://0.0.0.0:%d", scheme, opts.Ports.EtcdPeer))
+	} else {
+		// Other containers on the network reach etcd by its container name
+		command = append(command,
+			fmt.Sprintf("--advertise-client-urls=%s://%s:%d", scheme, containerName, etcdClientContainerPort),
+			fmt.Sprintf("--listen-client-urls=%s://0.0.0.0:%d", scheme, etcdClientContainerPort),
+			fmt.Sprintf("--listen-peer-urls=%s://0.0.0.0:%d", scheme, etcdPeerContainerPort))
+	}
+	volumes := []string{fmt.Sprintf("%s:/etcd-data", volumeName)} // Use volume
+	if opts.EtcdTLS != nil {
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", opts.EtcdTLS.CertsVolume, certsMount))
+		command = append(command,
+			"--client-cert-auth",
+			"--trusted-ca-file="+path.Join(certsMount, caCertFile),
+			"--cert-file="+path.Join(certsMount, etcdServerCertFile),
+			"--key-file="+path.Join(certsMount, etcdServerKeyFile),
+			"--peer-client-cert-auth",
+			"--peer-trusted-ca-file="+path.Join(certsMount, caCertFile),
+			"--peer-cert-file="+path.Join(certsMount, etcdPeerCertFile),
+			"--peer-key-file="+path.Join(certsMount, etcdPeerKeyFile))
+	}
+	runOpts := container.RunOptions{
+		Name:    containerName,
+		Image:   opts.Images.Etcd,
+		Detach:  true,
+		Volumes: volumes,
+		Command: command,
+	}
+	opts.Network.apply(&runOpts, opts.Ports.EtcdClient, etcdClientContainerPort)
 
-	// Generate certificates and keys in the Docker volume
-	fmt.Println("Generating certificates and keys in Docker volume...")
-	if err := GenerateSelfSignedCAInVolume(volumeName, volumeCertDir, hostIP); err != nil {
-		return fmt.Errorf("error generating self-signed CA: %v", err)
-	}
+	// Log the full command for debugging
+	fmt.Printf("Executing command: %s %s\n", rt.Name(), strings.Join(runOpts.Args(), " "))
 
-	// Path to encryption configuration
-	encryptionConfigPath := "./encryption-config.json"
-	if _, err := os.Stat(encryptionConfigPath); os.IsNotExist(err) {
-		return fmt.Errorf("encryption configuration file not found at %s", encryptionConfigPath)
+	// Capture and log the output of the command
+	rb.container(containerName)
+	output, err := rt.Run(ctx, runOpts)
+	fmt.Printf("Command output:\n%s\n", output)
+	if err != nil {
+		return fmt.Errorf("failed to start etcd server: %v", err)
 	}
 
-	// Start kube-apiserver with certificates from the Docker volume
-	fmt.Printf("Starting kube-apiserver container: %s...\n", containerName)
-	cmdRun := exec.Command("docker", "run", "-d", "--name", containerName,
-		"--network", "host", // Use host network mode
-		"-v", fmt.Sprintf("%s:%s", volumeName, volumeCertDir), // Mount Docker volume
-		"-v", fmt.Sprintf("%s:/etc/kubernetes/encryption-config.json", encryptionConfigPath), // Mount encryption config
-		"k8s.gcr.io/kube-apiserver:v1.27.1",
-		"/usr/local/bin/kube-apiserver",
-		"--etcd-servers="+etcdEndpoint,
-		"--service-cluster-ip-range=10.96.0.0/12",
-		"--allow-privileged=true",
-		"--anonymous-auth=true",
-		"--advertise-address=0.0.0.0",
-		"--service-account-signing-key-file="+caKeyPath,
-		"--service-account-issuer=https://kubernetes.default.svc.cluster.local",
-		"--service-account-key-file="+caCertPath,
-		"--tls-cert-file="+caCertPath,
-		"--tls-private-key-file="+caKeyPath,
-		"--client-ca-file="+caCertPath,
-		"--tls-cert-file="+caCertPath,
-		"--tls-private-key-file="+caKeyPath,
-		"--v=2") // Verbose logging level
-	cmdRun.Stdout = os.Stdout
-	cmdRun.Stderr = os.Stderr
-	if err := cmdRun.Run(); err != nil {
-		return fmt.Errorf("failed to start kube-apiserver: %v", err)
+	endpoint := fmt.Sprintf("%s://127.0.0.1:%d", scheme, opts.Ports.EtcdClient)
+	if opts.ReadyTimeout > 0 {
+		var tlsConfig *tls.Config
+		if opts.EtcdTLS != nil {
+			if tlsConfig, err = opts.EtcdTLS.clientConfig(); err != nil {
+				return err
+			}
+		}
+		if err := WaitForEtcd(ctx, rt, containerName, endpoint, tlsConfig, opts.ReadyTimeout); err != nil {
+			return err
+		}
 	}
 
-	fmt.Println("Kube-apiserver started successfully and is listening on port 8080.")
+	fmt.Printf("Etcd server started successfully and is listening on %s.\n", endpoint)
 	return nil
 }
 
-// GenerateSelfSignedCAWithSAN creates a self-signed CA certificate, private key, client certificate, and client key.
-func GenerateSelfSignedCAWithSAN(caCertPath, caKeyPath, clientCertPath, clientKeyPath, hostIP string) error {
-	// Generate the CA private key
-	caPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return fmt.Errorf("failed to generate CA private key: %v", err)
-	}
-
-	// Create the CA certificate template
-	caTemplate := x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Organization: []string{"Kubernetes"},
-			CommonName:   "Kubernetes CA",
-		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
-		BasicConstraintsValid: true,
-		IsCA:                  true,
-		IPAddresses:           []net.IP{net.ParseIP(hostIP)},
-	}
-
-	// Create the CA certificate
-	caCertDER, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, &caPriv.PublicKey, caPriv)
-	if err != nil {
-		return fmt.Errorf("failed to create CA certificate: %v", err)
-	}
-
-	// Write the CA certificate and private key to files
-	if err := writePEMFile(caCertPath, "CERTIFICATE", caCertDER); err != nil {
-		return fmt.Errorf("failed to write CA certificate: %v", err)
-	}
-
-	caPrivBytes, err := x509.MarshalECPrivateKey(caPriv)
-	if err != nil {
-		return fmt.Errorf("failed to marshal CA private key: %v", err)
-	}
-
-	if err := writePEMFile(caKeyPath, "EC PRIVATE KEY", caPrivBytes); err != nil {
-		return fmt.Errorf("failed to write CA private key: %v", err)
-	}
-
-	// Generate the client private key
-	clientPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return fmt.Errorf("failed to generate client private key: %v", err)
-	}
+// KubeAPIServerOptions customise the kube-apiserver started against the restored data.
+type KubeAPIServerOptions struct {
+	// ReadOnly authorizes only get, list and watch requests, so that the restored data
+	// cannot be changed through the API. Clients must use the viewer credentials, as
+	// kube-apiserver authorizes members of system:masters regardless of the policy.
+	ReadOnly bool
+	// DisableAdmissionWebhooks turns off the validating and mutating admission webhooks
+	// restored from the snapshot, whose services do not run next to the restored data.
+	DisableAdmissionWebhooks bool
+	// LocalAPIServices makes the APIServices served by extension API servers local-only once
+	// kube-apiserver is ready, so that discovery does not wait for servers that are not running.
+	// This changes the restored data, so it cannot be combined with ReadOnly, and needs the
+	// admin credentials in PKIDir.
+	LocalAPIServices bool
+	// PKIDir holds the certificates of the session on the host.
+	PKIDir string
+	// OutputDir receives the generated encryption configuration and read-only policy.
+	OutputDir string
+	// EncryptionConfigPath is the EncryptionConfiguration of the source cluster; an
+	// identity-only configuration is generated in OutputDir when empty.
+	EncryptionConfigPath string
+	// EtcdTLS, when set, makes kube-apiserver connect to etcd with its etcd client certificate.
+	EtcdTLS *EtcdTLS
+	// Network and Ports are those of the session; the kube-apiserver port is published on
+	// the loopback address in bridge mode.
+	Network Network
+	Ports   Ports
+	Images  Images
+	// ReadyTimeout, when positive, is how long to wait for kube-apiserver to report ready.
+	ReadyTimeout time.Duration
+}
 
-	// Create the client certificate template
-	clientTemplate := x509.Certificate{
-		SerialNumber: big.NewInt(2),
-		Subject: pkix.Name{
-			Organization: []string{"Kubernetes"},
-			CommonName:   "Kubernetes Client",
-		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().Add(365 * 24 * time.Hour),
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-		IPAddresses: []net.IP{net.ParseIP(hostIP)},
-	}
+// StartKubeAPIServer starts a kube-apiserver using the specified etcd endpoint and the certificates
+// of volumeName, see GeneratePKIInVolume, listening on the kube-apiserver port of opts.Ports. The
+// encryption configuration and the read-only policy are generated in opts.OutputDir as needed.
+// When opts.ReadyTimeout is positive it waits for kube-apiserver to report ready, which
+// opts.LocalAPIServices requires. When ctx is cancelled the container is removed.
+func StartKubeAPIServer(ctx context.Context, rt container.Runtime, etcdEndpoint, containerName, volumeName, hostIP string, opts KubeAPIServerOptions) (err error) {
+	rb := &rollback{rt: rt}
+	defer func() { rb.undoIfCancelled(ctx, err) }()
 
-	// Sign the client certificate with the CA
-	clientCertDER, err := x509.CreateCertificate(rand.Reader, &clientTemplate, &caTemplate, &clientPriv.PublicKey, caPriv)
-	if err != nil {
-		return fmt.Errorf("failed to create client certificate: %v", err)
-	}
+	// Remove existing kube-apiserver container if it exists
+	fmt.Printf("Removing existing kube-apiserver container: %s (if running)...\n", containerName)
+	_ = rt.Remove(ctx, containerName) // Ignore errors if the container doesn't exist
 
-	// Write the client certificate and private key to files
-	if err := writePEMFile(clientCertPath, "CERTIFICATE", clientCertDER); err != nil {
-		return fmt.Errorf("failed to write client certificate: %v", err)
+	if etcdEndpoint == "" {
+		return fmt.Errorf("etcd endpoint is required to start kube-apiserver")
 	}
-
-	clientPrivBytes, err := x509.MarshalECPrivateKey(clientPriv)
-	if err != nil {
-		return fmt.Errorf("failed to marshal client private key: %v", err)
+	if opts.LocalAPIServices && opts.ReadyTimeout <= 0 {
+		return fmt.Errorf("local-only APIServices need kube-apiserver to become ready, set a wait timeout")
 	}
-
-	if err := writePEMFile(clientKeyPath, "EC PRIVATE KEY", clientPrivBytes); err != nil {
-		return fmt.Errorf("failed to write client private key: %v", err)
+	if opts.LocalAPIServices && opts.ReadOnly {
+		return fmt.Errorf("local-only APIServices change the restored data, which read-only mode protects")
 	}
 
-	fmt.Printf("CA and client certificates generated successfully:\n- CA Cert: %s\n- Client Cert: %s\n", caCertPath, clientCertPath)
-	return nil
-}
-
-// GenerateClientCert creates a client certificate and private key signed by the provided CA.
-func GenerateClientCert(caCertPath, caKeyPath, clientCertPath, clientKeyPath, hostIP string) error {
-	// Read CA certificate
-	caCertPEM, err := os.ReadFile(caCertPath)
+	// Resolve the encryption configuration, bind mounts require an absolute path
+	encryptionConfigPath, err := prepareEncryptionConfig(opts.EncryptionConfigPath, opts.OutputDir)
 	if err != nil {
-		return fmt.Errorf("failed to read CA certificate: %v", err)
+		return err
 	}
 
-	// Parse CA certificate
-	caCertBlock, _ := pem.Decode(caCertPEM)
-	if caCertBlock == nil {
-		return fmt.Errorf("failed to decode CA certificate PEM")
-	}
-	caCert, err := x509.ParseCertificate(caCertBlock.Bytes)
-	if err != nil {
-		return fmt.Errorf("failed to parse CA certificate: %v", err)
+	// Make the kube-apiserver image available according to the pull policy
+	if err := EnsureImage(ctx, rt, opts.Images.KubeAPIServer, opts.Images.PullPolicy); err != nil {
+		return fmt.Errorf("failed to prepare kube-apiserver image: %v", err)
 	}
 
-	// Read CA private key
-	caKeyPEM, err := os.ReadFile(caKeyPath)
+	// Join the network etcd was started on, creating it if needed
+	created, err := ensureNetwork(ctx, rt, opts.Network)
 	if err != nil {
-		return fmt.Errorf("failed to read CA private key: %v", err)
-	}
-	caKeyBlock, _ := pem.Decode(caKeyPEM)
-	if caKeyBlock == nil {
-		return fmt.Errorf("failed to decode CA private key PEM")
+		return err
 	}
-	caKey, err := x509.ParseECPrivateKey(caKeyBlock.Bytes)
-	if err != nil {
-		return fmt.Errorf("failed to parse CA private key: %v", err)
+	if created {
+		rb.network(opts.Network.Name)
 	}
 
-	// Generate client key pair
-	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return fmt.Errorf("failed to generate client private key: %v", err)
-	}
+	// Paths inside the volume
+	caCertPath := path.Join(certsMount, caCertFile)
 
-	// Create client certificate template
-	clientCertTemplate := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().Unix()),
-		Subject: pkix.Name{
-			Organization: []string{"Kubernetes"},
-			CommonName:   "Kubernetes Client",
-		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().Add(365 * 24 * time.Hour),
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-		IPAddresses: []net.IP{net.ParseIP(hostIP)},
+	// kube-apiserver listens on the session port with host networking, or on its
+	// standard port inside the container in bridge mode
+	securePort := kubeAPIServerContainerPort
+	if opts.Network.IsHost() {
+		securePort = opts.Ports.KubeAPIServer
 	}
 
-	// Sign client certificate
-	clientCertDER, err := x509.CreateCertificate(rand.Reader, &clientCertTemplate, caCert, &clientKey.PublicKey, caKey)
+	command := []string{"/usr/local/bin/kube-apiserver",
+		"--etcd-servers=" + etcdEndpoint,
+		"--service-cluster-ip-range=" + serviceClusterIPRange,
+		"--allow-privileged=true",
+		"--anonymous-auth=true",
+		"--advertise-address=0.0.0.0",
+		fmt.Sprintf("--secure-port=%d", securePort),
+		"--service-account-signing-key-file=" + path.Join(certsMount, saKeyFile),
+		"--service-account-issuer=https://kubernetes.default.svc.cluster.local",
+		"--service-account-key-file=" + path.Join(certsMount, saPubFile),
+		"--tls-cert-file=" + path.Join(certsMount, apiServerCertFile),
+		"--tls-private-key-file=" + path.Join(certsMount, apiServerKeyFile),
+		"--client-ca-file=" + caCertPath,
+		"--token-auth-file=" + path.Join(certsMount, tokenFile),
+		"--encryption-provider-config=" + encryptionConfigMount,
+	}
+	volumes := []string{
+		fmt.Sprintf("%s:%s", volumeName, certsMount),                      // Mount certificate volume
+		fmt.Sprintf("%s:%s", encryptionConfigPath, encryptionConfigMount), // Mount encryption config
+	}
+	if opts.ReadOnly {
+		// ABAC reads its policy from a file, so nothing is written to the restored data
+		policyPath, err := writeReadOnlyPolicy(opts.OutputDir)
+		if err != nil {
+			return err
+		}
+		command = append(command, "--authorization-mode=ABAC", "--authorization-policy-file="+readOnlyPolicyMount)
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", policyPath, readOnlyPolicyMount))
+	}
+	if opts.DisableAdmissionWebhooks {
+		command = append(command, "--disable-admission-plugins=MutatingAdmissionWebhook,ValidatingAdmissionWebhook")
+	}
+	if opts.EtcdTLS != nil {
+		command = append(command,
+			"--etcd-cafile="+caCertPath,
+			"--etcd-certfile="+path.Join(certsMount, etcdClientCertFile),
+			"--etcd-keyfile="+path.Join(certsMount, etcdClientKeyFile))
+	}
+	command = append(command, "--v=2") // Verbose logging level
+
+	// Start kube-apiserver with certificates from the volume
+	fmt.Printf("Starting kube-apiserver container: %s...\n", containerName)
+	runOpts := container.RunOptions{
+		Name:    containerName,
+		Image:   opts.Images.KubeAPIServer,
+		Detach:  true,
+		Volumes: volumes,
+		Command: command,
+	}
+	opts.Network.apply(&runOpts, opts.Ports.KubeAPIServer, kubeAPIServerContainerPort)
+	rb.container(containerName)
+	_, err = rt.Run(ctx, runOpts)
 	if err != nil {
-		return fmt.Errorf("failed to create client certificate: %v", err)
+		return fmt.Errorf("failed to start kube-apiserver: %v", err)
 	}
 
-	// Write client certificate
-	clientCertFile, err := os.Create(clientCertPath)
-	if err != nil {
-		return fmt.Errorf("failed to create client certificate file: %v", err)
-	}
-	defer clientCertFile.Close()
-	if err := pem.Encode(clientCertFile, &pem.Block{Type: "CERTIFICATE", Bytes: clientCertDER}); err != nil {
-		return fmt.Errorf("failed to encode client certificate to PEM: %v", err)
+	if opts.ReadyTimeout > 0 {
+		if err := WaitForKubeAPIServer(ctx, rt, containerName, opts.Ports.KubeAPIServerURL(), opts.ReadyTimeout); err != nil {
+			return err
+		}
 	}
-
-	// Marshal client private key
-	clientKeyBytes, err := x509.MarshalECPrivateKey(clientKey)
-	if err != nil {
-		return fmt.Errorf("failed to marshal client private key: %v", err)
+	if opts.LocalAPIServices {
+		tlsConfig, err := clientTLSConfig(opts.PKIDir, adminUser.certFile, adminUser.keyFile)
+		if err != nil {
+			return err
+		}
+		// The serving certificate is issued for 127.0.0.1, which the URL of both network modes uses
+		if _, err := localizeAPIServices(ctx, opts.Ports.KubeAPIServerURL(), tlsConfig); err != nil {
+			return err
+		}
 	}
 
-	// Write client private key
-	clientKeyFile, err := os.Create(clientKeyPath)
-	if err != nil {
-		return fmt.Errorf("failed to create client private key file: %v", err)
-	}
-	defer clientKeyFile.Close()
-	if err := pem.Encode(clientKeyFile, &pem.Block{Type: "EC PRIVATE KEY", Bytes: clientKeyBytes}); err != nil {
-		return fmt.Errorf("failed to encode client private key to PEM: %v", err)
+	fmt.Printf("Kube-apiserver started successfully and is listening on %s.\n", opts.Network.KubeAPIServerURL(hostIP, opts.Ports))
+	if opts.ReadOnly {
+		fmt.Printf("READ-ONLY MODE: kube-apiserver only authorizes get, list and watch; use the %s credentials, system:masters is not restricted.\n", ViewerGroup)
 	}
-
-	fmt.Printf("Client certificate and key generated at: %s, %s\n", clientCertPath, clientKeyPath)
 	return nil
 }
 
-// writePEMFile writes data to a PEM file.
-func writePEMFile(path, blockType string, data []byte) error {
-	file, err := os.Create(path)
+// prepareEncryptionConfig validates the given encryption configuration, or writes an
+// identity-only one to outputDir, and returns its absolute path.
+func prepareEncryptionConfig(path, outputDir string) (string, error) {
+	if path == "" {
+		path = filepath.Join(outputDir, "encryption-config.json")
+		fmt.Printf("Generating identity-only encryption configuration: %s...\n", path)
+		if err := encryption.Identity().Write(path); err != nil {
+			return "", err
+		}
+	} else {
+		config, err := encryption.Load(path)
+		if err != nil {
+			return "", err
+		}
+		if err := config.CheckUsable(); err != nil {
+			return "", err
+		}
+		fmt.Printf("Using encryption configuration: %s\n", path)
+	}
+
+	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to resolve encryption configuration path: %v", err)
 	}
-	defer file.Close()
-
-	return pem.Encode(file, &pem.Block{Type: blockType, Bytes: data})
+	return absPath, nil
 }
 
-// getHostIPAddress retrieves the primary IP address of the host.
-func getHostIPAddress() (string, error) {
+// HostIPAddress retrieves the primary IP address of the host.
+func HostIPAddress() (string, error) {
 	// Execute the hostname -I command to get the IP addresses
 	cmd := exec.Command("hostname", "-I")
 	var stdout bytes.Buffer
@@ -342,149 +337,3 @@ func getHostIPAddress() (string, error) {
 
 	return ipAddresses[0], nil
 }
-
-// GenerateSelfSignedCAInVolume generates a self-signed CA, client certificate, and client key with SAN, and stores them in a Docker volume.
-func GenerateSelfSignedCAInVolume(volumeName, volumeCertDir, hostIP string) error {
-	// Create a temporary directory for the certificates
-	tempDir, err := os.MkdirTemp("", "kube-apiserver-certs")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary directory: %v", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	// Paths for the CA cert and key
-	caCertPath := filepath.Join(tempDir, "ca.crt")
-	caKeyPath := filepath.Join(tempDir, "ca.key")
-	clientCertPath := filepath.Join(tempDir, "client.crt")
-	clientKeyPath := filepath.Join(tempDir, "client.key")
-
-	// Generate the self-signed CA and client credentials
-	fmt.Println("Generating self-signed CA and client certificates...")
-	if err := GenerateSelfSignedCAWithSAN(caCertPath, caKeyPath, clientCertPath, clientKeyPath, hostIP); err != nil {
-		return fmt.Errorf("failed to generate self-signed CA and client certificates: %v", err)
-	}
-
-	// Copy certificates and keys into the Docker volume
-	fmt.Printf("Copying certificates and keys into Docker volume: %s...\n", volumeName)
-	cmdCopyCert := exec.Command("docker", "run", "--rm",
-		"-v", fmt.Sprintf("%s:%s", volumeName, volumeCertDir),
-		"-v", fmt.Sprintf("%s:/tmp/certs", tempDir),
-		"alpine", "sh", "-c", "cp /tmp/certs/* /certs/")
-	cmdCopyCert.Stdout = os.Stdout
-	cmdCopyCert.Stderr = os.Stderr
-	if err := cmdCopyCert.Run(); err != nil {
-		return fmt.Errorf("failed to copy certificates and keys into Docker volume: %v", err)
-	}
-
-	fmt.Println("Certificates and keys successfully stored in Docker volume.")
-	return nil
-}
-
-// GenerateKubeconfig creates a kubeconfig file using certs copied from the kube-apiserver container.
-func GenerateKubeconfig(kubeconfigPath, serverURL, containerName string) error {
-	const kubeconfigTemplate = `
-apiVersion: v1
-kind: Config
-clusters:
-- cluster:
-    server: {{ .ServerURL }}
-    certificate-authority-data: {{ .CACertData }}
-  name: kubernetes
-contexts:
-- context:
-    cluster: kubernetes
-    user: admin
-  name: kubernetes
-current-context: kubernetes
-users:
-- name: admin
-  user:
-    client-certificate-data: {{ .ClientCertData }}
-    client-key-data: {{ .ClientKeyData }}
-`
-
-	// Create a temporary directory to copy certs from the container
-	tempDir, err := os.MkdirTemp("", "kubeconfig-certs")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary directory: %v", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	// Paths inside the container
-	caCertContainerPath := "/certs/ca.crt"
-	clientCertContainerPath := "/certs/client.crt"
-	clientKeyContainerPath := "/certs/client.key"
-
-	// Local paths to store the copied certs
-	caCertLocalPath := filepath.Join(tempDir, "ca.crt")
-	clientCertLocalPath := filepath.Join(tempDir, "client.crt")
-	clientKeyLocalPath := filepath.Join(tempDir, "client.key")
-
-	// Copy certificates from the kube-apiserver container
-	if err := copyFileFromContainer(containerName, caCertContainerPath, caCertLocalPath); err != nil {
-		return fmt.Errorf("failed to copy CA certificate from container: %v", err)
-	}
-	if err := copyFileFromContainer(containerName, clientCertContainerPath, clientCertLocalPath); err != nil {
-		return fmt.Errorf("failed to copy client certificate from container: %v", err)
-	}
-	if err := copyFileFromContainer(containerName, clientKeyContainerPath, clientKeyLocalPath); err != nil {
-		return fmt.Errorf("failed to copy client key from container: %v", err)
-	}
-
-	// Read and encode the certs
-	caCertBytes, err := os.ReadFile(caCertLocalPath)
-	if err != nil {
-		return fmt.Errorf("failed to read CA certificate: %v", err)
-	}
-	clientCertBytes, err := os.ReadFile(clientCertLocalPath)
-	if err != nil {
-		return fmt.Errorf("failed to read client certificate: %v", err)
-	}
-	clientKeyBytes, err := os.ReadFile(clientKeyLocalPath)
-	if err != nil {
-		return fmt.Errorf("failed to read client key: %v", err)
-	}
-
-	// Base64 encode the certs
-	data := struct {
-		ServerURL      string
-		CACertData     string
-		ClientCertData string
-		ClientKeyData  string
-	}{
-		ServerURL:      serverURL,
-		CACertData:     base64.StdEncoding.EncodeToString(caCertBytes),
-		ClientCertData: base64.StdEncoding.EncodeToString(clientCertBytes),
-		ClientKeyData:  base64.StdEncoding.EncodeToString(clientKeyBytes),
-	}
-
-	// Write the kubeconfig file
-	file, err := os.Create(kubeconfigPath)
-	if err != nil {
-		return fmt.Errorf("failed to create kubeconfig file: %v", err)
-	}
-	defer file.Close()
-
-	tmpl, err := template.New("kubeconfig").Parse(kubeconfigTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse kubeconfig template: %v", err)
-	}
-
-	if err := tmpl.Execute(file, data); err != nil {
-		return fmt.Errorf("failed to write kubeconfig file: %v", err)
-	}
-
-	fmt.Printf("Kubeconfig generated at: %s\n", kubeconfigPath)
-	return nil
-}
-
-// copyFileFromContainer copies a file from a Docker container to a local path.
-func copyFileFromContainer(containerName, containerPath, localPath string) error {
-	cmd := exec.Command("docker", "cp", fmt.Sprintf("%s:%s", containerName, containerPath), localPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to copy file from container: %v", err)
-	}
-	return nil
-}
@@ -0,0 +1,265 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/container"
+)
+
+func TestStartEtcdServer(t *testing.T) {
+	rt := container.NewFake()
+
+	if err := StartEtcdServer(context.Background(), rt, "data", "etcd", "192.0.2.10", EtcdServerOptions{Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages}); err != nil {
+		t.Fatalf("StartEtcdServer: %v", err)
+	}
+
+	want := []string{
+		"rm etcd",
+		"pull etcd:test",
+		"network-exists snapshot-insight",
+		"network-create snapshot-insight",
+		"run -d --name etcd --network snapshot-insight -p 127.0.0.1:2379:2379 -v data:/etcd-data etcd:test " +
+			"/usr/local/bin/etcd --name=restored-etcd --data-dir=/etcd-data --advertise-client-urls=http://etcd:2379 " +
+			"--listen-client-urls=http://0.0.0.0:2379 --listen-peer-urls=http://0.0.0.0:2380",
+	}
+	if !reflect.DeepEqual(rt.Ops(), want) {
+		t.Errorf("ops mismatch\ngot:  %q\nwant: %q", rt.Ops(), want)
+	}
+}
+
+func TestStartEtcdServerExistingNetwork(t *testing.T) {
+	rt := container.NewFake()
+	rt.Networks["snapshot-insight"] = true
+
+	if err := StartEtcdServer(context.Background(), rt, "data", "etcd", "192.0.2.10", EtcdServerOptions{Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages}); err != nil {
+		t.Fatalf("StartEtcdServer: %v", err)
+	}
+	if creates := rt.CallsFor("network-create"); len(creates) != 0 {
+		t.Errorf("expected the existing network to be reused, got %v", creates)
+	}
+}
+
+func TestStartSessionPorts(t *testing.T) {
+	ports := Ports{EtcdClient: 32379, EtcdPeer: 32380, KubeAPIServer: 36443}
+
+	tests := []struct {
+		name              string
+		network           Network
+		wantEtcdArgs      []string
+		wantAPIServerArgs []string
+	}{
+		{
+			name:    "bridge",
+			network: Network{Mode: NetworkBridge, Name: "insight-a"},
+			wantEtcdArgs: []string{
+				"--network insight-a -p 127.0.0.1:32379:2379",
+				"--advertise-client-urls=http://etcd:2379",
+				"--listen-client-urls=http://0.0.0.0:2379",
+				"--listen-peer-urls=http://0.0.0.0:2380",
+			},
+			wantAPIServerArgs: []string{"--network insight-a -p 127.0.0.1:36443:6443", "--etcd-servers=http://etcd:2379", "--secure-port=6443"},
+		},
+		{
+			name:    "host",
+			network: Network{Mode: NetworkHost},
+			wantEtcdArgs: []string{
+				"--network host -v",
+				"--advertise-client-urls=http://127.0.0.1:32379,http://192.0.2.10:32379",
+				"--listen-client-urls=http://0.0.0.0:32379",
+				"--listen-peer-urls=http://0.0.0.0:32380",
+			},
+			wantAPIServerArgs: []string{"--network host -v", "--etcd-servers=http://127.0.0.1:32379", "--secure-port=36443"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := container.NewFake()
+
+			if err := StartEtcdServer(context.Background(), rt, "data", "etcd", "192.0.2.10", EtcdServerOptions{Network: tt.network, Ports: ports, Images: testImages}); err != nil {
+				t.Fatalf("StartEtcdServer: %v", err)
+			}
+			rt.Networks[tt.network.Name] = true
+			if err := StartKubeAPIServer(context.Background(), rt, tt.network.EtcdEndpoint("etcd", nil, ports), "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{OutputDir: t.TempDir(), Network: tt.network, Ports: ports, Images: testImages}); err != nil {
+				t.Fatalf("StartKubeAPIServer: %v", err)
+			}
+
+			runs := rt.CallsFor("run")
+			etcdArgs, apiServerArgs := strings.Join(runs[0].Args, " "), strings.Join(runs[1].Args, " ")
+			for _, want := range tt.wantEtcdArgs {
+				if !strings.Contains(etcdArgs, want) {
+					t.Errorf("etcd args missing %s: %s", want, etcdArgs)
+				}
+			}
+			for _, want := range tt.wantAPIServerArgs {
+				if !strings.Contains(apiServerArgs, want) {
+					t.Errorf("kube-apiserver args missing %s: %s", want, apiServerArgs)
+				}
+			}
+			if tt.network.IsHost() && len(rt.CallsFor("network-create")) > 0 {
+				t.Errorf("expected no network in host mode, got %q", rt.Ops())
+			}
+		})
+	}
+}
+
+func TestStartEtcdServerRunFailure(t *testing.T) {
+	rt := container.NewFake()
+	rt.Errors["run"] = errors.New("port is already allocated")
+
+	err := StartEtcdServer(context.Background(), rt, "data", "etcd", "192.0.2.10", EtcdServerOptions{Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages})
+	checkErr(t, err, "failed to start etcd server: port is already allocated")
+}
+
+func TestStartKubeAPIServer(t *testing.T) {
+	dir := t.TempDir()
+	rt := container.NewFake()
+
+	if err := StartKubeAPIServer(context.Background(), rt, "http://127.0.0.1:2379", "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{OutputDir: dir, Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages}); err != nil {
+		t.Fatalf("StartKubeAPIServer: %v", err)
+	}
+
+	ops := rt.Ops()
+	if len(ops) != 5 || ops[0] != "rm apiserver" || ops[1] != "pull apiserver:test" || ops[3] != "network-create snapshot-insight" {
+		t.Fatalf("unexpected ops: %q", ops)
+	}
+
+	runs := rt.CallsFor("run")
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+
+	encryptionConfigPath := filepath.Join(dir, "encryption-config.json")
+	want := []string{
+		"-d", "--name", "apiserver", "--network", "snapshot-insight",
+		"-p", "127.0.0.1:6443:6443",
+		"-v", "certs:/certs",
+		"-v", encryptionConfigPath + ":/etc/kubernetes/encryption-config.json",
+		"apiserver:test",
+		"/usr/local/bin/kube-apiserver",
+		"--etcd-servers=http://127.0.0.1:2379",
+		"--service-cluster-ip-range=10.96.0.0/12",
+		"--allow-privileged=true",
+		"--anonymous-auth=true",
+		"--advertise-address=0.0.0.0",
+		"--secure-port=6443",
+		"--service-account-signing-key-file=/certs/sa.key",
+		"--service-account-issuer=https://kubernetes.default.svc.cluster.local",
+		"--service-account-key-file=/certs/sa.pub",
+		"--tls-cert-file=/certs/apiserver.crt",
+		"--tls-private-key-file=/certs/apiserver.key",
+		"--client-ca-file=/certs/ca.crt",
+		"--token-auth-file=/certs/tokens.csv",
+		"--encryption-provider-config=/etc/kubernetes/encryption-config.json",
+		"--v=2",
+	}
+	if !reflect.DeepEqual(runs[0].Args, want) {
+		t.Errorf("kube-apiserver args mismatch\ngot:  %q\nwant: %q", runs[0].Args, want)
+	}
+
+	config, err := os.ReadFile(encryptionConfigPath)
+	if err != nil {
+		t.Fatalf("expected a generated encryption configuration: %v", err)
+	}
+	if !strings.Contains(string(config), `"identity": {}`) {
+		t.Errorf("expected an identity-only encryption configuration, got:\n%s", config)
+	}
+}
+
+func TestStartKubeAPIServerEncryptionConfig(t *testing.T) {
+	encryptionConfigPath := filepath.Join(t.TempDir(), "enc.yaml")
+	config := `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+- resources: [secrets]
+  providers:
+  - aescbc:
+      keys:
+      - name: key1
+        secret: c2VjcmV0IGlzIHNlY3VyZSwgb3IgaXMgaXQ/Cg==
+  - identity: {}
+`
+	if err := os.WriteFile(encryptionConfigPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := t.TempDir()
+	rt := container.NewFake()
+
+	if err := StartKubeAPIServer(context.Background(), rt, "http://127.0.0.1:2379", "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{OutputDir: outputDir, EncryptionConfigPath: encryptionConfigPath, Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages}); err != nil {
+		t.Fatalf("StartKubeAPIServer: %v", err)
+	}
+
+	runs := rt.CallsFor("run")
+	if mount := encryptionConfigPath + ":/etc/kubernetes/encryption-config.json"; !strings.Contains(strings.Join(runs[0].Args, " "), mount) {
+		t.Errorf("expected %s to be mounted, got %q", mount, runs[0].Args)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "encryption-config.json")); !os.IsNotExist(err) {
+		t.Errorf("expected no generated configuration when one is given")
+	}
+}
+
+func TestStartKubeAPIServerErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		etcdEndpoint string
+		// encryptionConfig is written to a file passed to StartKubeAPIServer; "missing" passes a path that does not exist
+		encryptionConfig string
+		errors           map[string]error
+		wantErr          string
+	}{
+		{
+			name:    "missing etcd endpoint",
+			wantErr: "etcd endpoint is required",
+		},
+		{
+			name:             "missing encryption config",
+			etcdEndpoint:     "http://127.0.0.1:2379",
+			encryptionConfig: "missing",
+			wantErr:          "failed to read encryption configuration",
+		},
+		{
+			name:             "wrong kind of encryption config",
+			etcdEndpoint:     "http://127.0.0.1:2379",
+			encryptionConfig: "apiVersion: v1\nkind: ConfigMap\n",
+			wantErr:          `kind is "ConfigMap"`,
+		},
+		{
+			name:             "kms encryption config",
+			etcdEndpoint:     "http://127.0.0.1:2379",
+			encryptionConfig: "kind: EncryptionConfiguration\nresources:\n- resources: [secrets]\n  providers:\n  - kms: {name: vault, endpoint: unix:///kms.sock}\n",
+			wantErr:          "KMS provider vault for secrets cannot be used",
+		},
+		{
+			name:         "run failure",
+			etcdEndpoint: "http://127.0.0.1:2379",
+			errors:       map[string]error{"run": errors.New("image not found")},
+			wantErr:      "failed to start kube-apiserver: image not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			encryptionConfigPath := ""
+			if tt.encryptionConfig != "" {
+				encryptionConfigPath = filepath.Join(dir, "source-encryption-config.yaml")
+				if tt.encryptionConfig != "missing" {
+					if err := os.WriteFile(encryptionConfigPath, []byte(tt.encryptionConfig), 0o600); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			rt := container.NewFake()
+			rt.Errors = tt.errors
+
+			err := StartKubeAPIServer(context.Background(), rt, tt.etcdEndpoint, "apiserver", "certs", "192.0.2.10", KubeAPIServerOptions{OutputDir: dir, EncryptionConfigPath: encryptionConfigPath, Network: DefaultNetwork(), Ports: DefaultPorts(), Images: testImages})
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
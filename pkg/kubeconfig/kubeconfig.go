@@ -0,0 +1,222 @@
+// Package kubeconfig writes kubeconfig files and merges them into existing ones,
+// such as ~/.kube/config, without disturbing the entries of other clusters.
+package kubeconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is a kubeconfig. Only the fields written by snapshot-insight are modelled;
+// Merge keeps any other fields of an existing file.
+type Config struct {
+	APIVersion     string         `json:"apiVersion"`
+	Kind           string         `json:"kind"`
+	Clusters       []NamedCluster `json:"clusters"`
+	Contexts       []NamedContext `json:"contexts"`
+	CurrentContext string         `json:"current-context"`
+	Users          []NamedUser    `json:"users"`
+}
+
+// NamedCluster is a cluster entry of a kubeconfig.
+type NamedCluster struct {
+	Name    string  `json:"name"`
+	Cluster Cluster `json:"cluster"`
+}
+
+// Cluster is how to reach kube-apiserver.
+type Cluster struct {
+	Server                   string `json:"server"`
+	CertificateAuthorityData []byte `json:"certificate-authority-data,omitempty"`
+}
+
+// NamedContext is a context entry of a kubeconfig.
+type NamedContext struct {
+	Name    string  `json:"name"`
+	Context Context `json:"context"`
+}
+
+// Context pairs a cluster with a user and a default namespace.
+type Context struct {
+	Cluster   string `json:"cluster"`
+	User      string `json:"user"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NamedUser is a user entry of a kubeconfig.
+type NamedUser struct {
+	Name string `json:"name"`
+	User User   `json:"user"`
+}
+
+// User holds the credentials of a user: a client certificate, a bearer token or an
+// exec credential plugin.
+type User struct {
+	ClientCertificateData []byte      `json:"client-certificate-data,omitempty"`
+	ClientKeyData         []byte      `json:"client-key-data,omitempty"`
+	Token                 string      `json:"token,omitempty"`
+	Exec                  *ExecConfig `json:"exec,omitempty"`
+}
+
+// ExecConfig runs a command printing an ExecCredential to obtain credentials.
+type ExecConfig struct {
+	APIVersion      string   `json:"apiVersion"`
+	Command         string   `json:"command"`
+	Args            []string `json:"args,omitempty"`
+	InteractiveMode string   `json:"interactiveMode,omitempty"`
+}
+
+// ExecCredentialAPIVersion is the client.authentication.k8s.io version of exec plugins.
+const ExecCredentialAPIVersion = "client.authentication.k8s.io/v1"
+
+// ExecCredential is what an exec credential plugin prints.
+type ExecCredential struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Status     ExecCredentialStatus `json:"status"`
+}
+
+// ExecCredentialStatus holds the credentials returned by an exec plugin.
+type ExecCredentialStatus struct {
+	ClientCertificateData string `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string `json:"clientKeyData,omitempty"`
+	Token                 string `json:"token,omitempty"`
+}
+
+// New returns a kubeconfig whose cluster, user and current context are all called name.
+func New(name, server string, caData []byte, user User, namespace string) *Config {
+	return &Config{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []NamedCluster{{Name: name, Cluster: Cluster{Server: server, CertificateAuthorityData: caData}}},
+		Contexts:       []NamedContext{{Name: name, Context: Context{Cluster: name, User: name, Namespace: namespace}}},
+		CurrentContext: name,
+		Users:          []NamedUser{{Name: name, User: user}},
+	}
+}
+
+// DefaultPath returns the first file of $KUBECONFIG, or ~/.kube/config.
+func DefaultPath() (string, error) {
+	if paths := filepath.SplitList(os.Getenv("KUBECONFIG")); len(paths) > 0 && paths[0] != "" {
+		return paths[0], nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %v", err)
+	}
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+// Write writes the kubeconfig to path, readable by the owner only.
+func (c *Config) Write(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode kubeconfig: %v", err)
+	}
+	return writeFile(path, data)
+}
+
+// Merge adds the clusters, contexts and users of c to the kubeconfig at path, replacing
+// entries of the same name, and makes the context of c current. Other entries and fields
+// are kept. The file is created when it does not exist.
+func Merge(path string, c *Config) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c.Write(path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read kubeconfig %s: %v", path, err)
+	}
+
+	existing := map[string]any{}
+	if err := yaml.Unmarshal(data, &existing); err != nil {
+		return fmt.Errorf("failed to parse kubeconfig %s: %v", path, err)
+	}
+	if existing == nil {
+		existing = map[string]any{}
+	}
+
+	// Round trip c through JSON so that its entries have the same form as the parsed ones
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode kubeconfig: %v", err)
+	}
+	added := map[string]any{}
+	if err := json.Unmarshal(encoded, &added); err != nil {
+		return fmt.Errorf("failed to encode kubeconfig: %v", err)
+	}
+
+	for _, key := range []string{"clusters", "contexts", "users"} {
+		entries, _ := existing[key].([]any)
+		newEntries, _ := added[key].([]any)
+		existing[key] = mergeEntries(entries, newEntries)
+	}
+	for _, key := range []string{"apiVersion", "kind"} {
+		if _, ok := existing[key]; !ok {
+			existing[key] = added[key]
+		}
+	}
+	existing["current-context"] = c.CurrentContext
+
+	merged, err := yaml.Marshal(existing)
+	if err != nil {
+		return fmt.Errorf("failed to encode kubeconfig: %v", err)
+	}
+	return writeFile(path, merged)
+}
+
+// mergeEntries replaces the entries of the same name with the added ones and appends the rest.
+func mergeEntries(entries, added []any) []any {
+	for _, entry := range added {
+		name := entryName(entry)
+		replaced := false
+		for i := range entries {
+			if entryName(entries[i]) == name {
+				entries[i], replaced = entry, true
+				break
+			}
+		}
+		if !replaced {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// entryName returns the name of a named kubeconfig entry.
+func entryName(entry any) string {
+	m, _ := entry.(map[string]any)
+	name, _ := m["name"].(string)
+	return name
+}
+
+// writeFile writes data to path, creating its directory, readable by the owner only.
+// The data is written to a temporary file next to path that is renamed over it, so
+// that an existing kubeconfig is never left truncated.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create directory for kubeconfig: %v", err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write kubeconfig %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write kubeconfig %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write kubeconfig %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write kubeconfig %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "kubeconfig")
+	config := New("snapshot", "https://127.0.0.1:6443", []byte("ca"), User{Token: "secret"}, "kube-system")
+
+	if err := config.Write(path); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"server: https://127.0.0.1:6443",
+		"certificate-authority-data: Y2E=",
+		"namespace: kube-system",
+		"token: secret",
+		"current-context: snapshot",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("kubeconfig missing %q:\n%s", want, data)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected a kubeconfig readable by the owner only, got %v, %v", info.Mode(), err)
+	}
+
+	loaded := &Config{}
+	if err := yaml.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("failed to parse kubeconfig: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("kubeconfig does not round trip\ngot:  %+v\nwant: %+v", loaded, config)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	existing := `apiVersion: v1
+kind: Config
+preferences:
+  colors: true
+clusters:
+- name: production
+  cluster:
+    server: https://prod.example.com
+    proxy-url: http://proxy.example.com
+- name: snapshot
+  cluster:
+    server: https://127.0.0.1:1
+contexts:
+- name: production
+  context:
+    cluster: production
+    user: production
+current-context: production
+users:
+- name: production
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1
+      command: aws
+`
+	if err := os.WriteFile(path, []byte(existing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := New("snapshot", "https://127.0.0.1:6443", []byte("ca"), User{Token: "secret"}, "")
+	if err := Merge(path, config); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := map[string]any{}
+	if err := yaml.Unmarshal(data, &merged); err != nil {
+		t.Fatalf("failed to parse merged kubeconfig: %v", err)
+	}
+
+	if merged["current-context"] != "snapshot" {
+		t.Errorf("current-context = %v, want snapshot", merged["current-context"])
+	}
+	if !reflect.DeepEqual(merged["preferences"], map[string]any{"colors": true}) {
+		t.Errorf("preferences were not kept: %v", merged["preferences"])
+	}
+	for _, want := range []string{"proxy-url: http://proxy.example.com", "command: aws", "server: https://127.0.0.1:6443", "token: secret"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("merged kubeconfig missing %q:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "https://127.0.0.1:1") {
+		t.Errorf("the existing snapshot cluster was not replaced:\n%s", data)
+	}
+	for key, want := range map[string]int{"clusters": 2, "contexts": 2, "users": 2} {
+		if got := len(merged[key].([]any)); got != want {
+			t.Errorf("%d %s, want %d", got, key, want)
+		}
+	}
+	if entries, err := os.ReadDir(filepath.Dir(path)); err != nil || len(entries) != 1 {
+		t.Errorf("expected only the kubeconfig to be left in its directory, got %v, %v", entries, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected a kubeconfig readable by the owner only, got %v, %v", info.Mode(), err)
+	}
+}
+
+func TestMergeCreates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".kube", "config")
+	config := New("snapshot", "https://127.0.0.1:6443", nil, User{Token: "secret"}, "")
+
+	if err := Merge(path, config); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the kubeconfig to be created: %v", err)
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("KUBECONFIG", strings.Join([]string{"/tmp/first", "/tmp/second"}, string(os.PathListSeparator)))
+	if got, err := DefaultPath(); err != nil || got != "/tmp/first" {
+		t.Errorf("DefaultPath() = %s, %v, want /tmp/first", got, err)
+	}
+
+	t.Setenv("KUBECONFIG", "")
+	t.Setenv("HOME", "/home/user")
+	if got, err := DefaultPath(); err != nil || got != "/home/user/.kube/config" {
+		t.Errorf("DefaultPath() = %s, %v, want /home/user/.kube/config", got, err)
+	}
+}
@@ -0,0 +1,229 @@
+// Package kubeversion infers the Kubernetes version of the cluster a snapshot
+// was taken from, so that a compatible kube-apiserver can be started.
+package kubeversion
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/supporttools/snapshot-insight/pkg/decode"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+)
+
+// Source kinds, from most to least precise.
+const (
+	SourceKubeadmConfig = "kubeadm-config"
+	SourceNode          = "node"
+	SourceStoredAPI     = "stored-api"
+)
+
+const (
+	nodesPrefix         = "/registry/minions/"
+	kubeadmConfigKey    = "/registry/configmaps/kube-system/kubeadm-config"
+	controlPlaneLabel   = "node-role.kubernetes.io/control-plane"
+	legacyMasterLabel   = "node-role.kubernetes.io/master"
+	clusterConfigDataID = "ClusterConfiguration"
+)
+
+// storedAPIs maps the API versions of stored objects to the first release that
+// served them. Finding one proves the cluster ran at least that release.
+var storedAPIs = []struct {
+	prefix     string
+	apiVersion string
+	since      string
+}{
+	{prefix: "/registry/validatingadmissionpolicies/", apiVersion: "admissionregistration.k8s.io/v1", since: "v1.30.0"},
+	{prefix: "/registry/flowschemas/", apiVersion: "flowcontrol.apiserver.k8s.io/v1", since: "v1.29.0"},
+	{prefix: "/registry/validatingadmissionpolicies/", apiVersion: "admissionregistration.k8s.io/v1beta1", since: "v1.28.0"},
+	{prefix: "/registry/flowschemas/", apiVersion: "flowcontrol.apiserver.k8s.io/v1beta3", since: "v1.26.0"},
+	{prefix: "/registry/csistoragecapacities/", apiVersion: "storage.k8s.io/v1", since: "v1.24.0"},
+	{prefix: "/registry/horizontalpodautoscalers/", apiVersion: "autoscaling/v2", since: "v1.23.0"},
+}
+
+// ErrNotFound is returned when the snapshot holds no version information.
+var ErrNotFound = errors.New("no Kubernetes version information found in snapshot")
+
+// Evidence is a single hint about the source cluster version.
+type Evidence struct {
+	Source  string `json:"source"`
+	Detail  string `json:"detail"`
+	Version string `json:"version"`
+}
+
+// Result is the detected version together with the evidence it was chosen from.
+type Result struct {
+	// Version is the detected release, e.g. "v1.28.5".
+	Version string `json:"version"`
+	// Source is the kind of evidence Version was taken from.
+	Source string `json:"source"`
+	// Exact is false when Version is only a lower bound derived from stored APIs.
+	Exact    bool       `json:"exact"`
+	Evidence []Evidence `json:"evidence"`
+}
+
+// Detect infers the Kubernetes version from the kubeadm-config ConfigMap, the
+// kubelet versions of control plane (or, failing that, all) nodes, and finally
+// the API versions objects were stored with. RKE2 and k3s keep no ConfigMap with
+// the cluster version; their nodes are the signal, as the kubelets report the
+// release with a distribution suffix such as v1.29.4+rke2r1.
+func Detect(snap *snapshot.Snapshot) (*Result, error) {
+	// Read every key the signals come from in a single pass over the snapshot
+	prefixes := []string{kubeadmConfigKey, nodesPrefix}
+	for _, api := range storedAPIs {
+		prefixes = append(prefixes, api.prefix)
+	}
+	kvs, err := snap.KeysWithPrefixes(prefixes...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	kubeadm := kubeadmVersion(kvs)
+	nodes := nodeVersions(kvs)
+	stored := storedAPIVersions(kvs)
+	result.Evidence = append(append(append(result.Evidence, kubeadm...), nodes...), stored...)
+
+	switch {
+	case len(kubeadm) > 0:
+		result.Version, result.Source, result.Exact = kubeadm[0].Version, SourceKubeadmConfig, true
+	case len(nodes) > 0:
+		result.Version, result.Source, result.Exact = highest(nodes), SourceNode, true
+	case len(stored) > 0:
+		result.Version, result.Source = highest(stored), SourceStoredAPI
+	default:
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+// Normalize strips distribution suffixes such as "+rke2r1" or "+k3s1" and
+// returns a "vMAJOR.MINOR.PATCH" release.
+func Normalize(v string) (string, error) {
+	parsed, err := version.ParseGeneric(strings.TrimSpace(v))
+	if err != nil {
+		return "", fmt.Errorf("invalid Kubernetes version %q: %v", v, err)
+	}
+	return fmt.Sprintf("v%d.%d.%d", parsed.Major(), parsed.Minor(), parsed.Patch()), nil
+}
+
+// Image returns image with its tag or digest replaced by the given release.
+func Image(image, release string) string {
+	repository, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+	return repository + ":" + release
+}
+
+// kubeadmVersion reads kubernetesVersion from the kubeadm ClusterConfiguration.
+func kubeadmVersion(kvs []snapshot.KeyValue) []Evidence {
+	for _, kv := range kvs {
+		if kv.Key != kubeadmConfigKey {
+			continue
+		}
+		obj, err := decode.Decode(kv.Value)
+		if err != nil {
+			return nil
+		}
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return nil
+		}
+
+		var clusterConfig struct {
+			KubernetesVersion string `json:"kubernetesVersion"`
+		}
+		if err := yaml.Unmarshal([]byte(configMap.Data[clusterConfigDataID]), &clusterConfig); err != nil {
+			return nil
+		}
+		release, err := Normalize(clusterConfig.KubernetesVersion)
+		if err != nil {
+			return nil
+		}
+		return []Evidence{{Source: SourceKubeadmConfig, Detail: "kube-system/kubeadm-config", Version: release}}
+	}
+	return nil
+}
+
+// nodeVersions collects kubelet versions, limited to control plane nodes when
+// the cluster labels them. Kubelets never run newer than the apiserver.
+func nodeVersions(kvs []snapshot.KeyValue) []Evidence {
+	var all, controlPlane []Evidence
+	for _, kv := range kvs {
+		if !strings.HasPrefix(kv.Key, nodesPrefix) {
+			continue
+		}
+		obj, err := decode.Decode(kv.Value)
+		if err != nil {
+			continue
+		}
+		node, ok := obj.(*corev1.Node)
+		if !ok {
+			continue
+		}
+		release, err := Normalize(node.Status.NodeInfo.KubeletVersion)
+		if err != nil {
+			continue
+		}
+
+		evidence := Evidence{Source: SourceNode, Detail: fmt.Sprintf("node %s kubelet %s", node.Name, node.Status.NodeInfo.KubeletVersion), Version: release}
+		all = append(all, evidence)
+		if _, ok := node.Labels[controlPlaneLabel]; ok {
+			controlPlane = append(controlPlane, evidence)
+		} else if _, ok := node.Labels[legacyMasterLabel]; ok {
+			controlPlane = append(controlPlane, evidence)
+		}
+	}
+
+	if len(controlPlane) > 0 {
+		return controlPlane
+	}
+	return all
+}
+
+// storedAPIVersions derives lower bounds from the API versions of stored objects.
+// Only the first live object under each prefix is decoded.
+func storedAPIVersions(kvs []snapshot.KeyValue) []Evidence {
+	seen := map[string]string{}
+	var evidence []Evidence
+	for _, api := range storedAPIs {
+		apiVersion, ok := seen[api.prefix]
+		if !ok {
+			for _, kv := range kvs {
+				if !strings.HasPrefix(kv.Key, api.prefix) {
+					continue
+				}
+				if obj, err := decode.Decode(kv.Value); err == nil {
+					apiVersion = decode.Identify(obj).APIVersion
+				}
+				break
+			}
+			seen[api.prefix] = apiVersion
+		}
+
+		if apiVersion == api.apiVersion {
+			evidence = append(evidence, Evidence{Source: SourceStoredAPI, Detail: fmt.Sprintf("%s stored as %s", strings.TrimSuffix(strings.TrimPrefix(api.prefix, "/registry/"), "/"), apiVersion), Version: api.since})
+		}
+	}
+	return evidence
+}
+
+// highest returns the newest release among the evidence.
+func highest(evidence []Evidence) string {
+	var best *version.Version
+	var bestRelease string
+	for _, e := range evidence {
+		parsed, err := version.ParseGeneric(e.Version)
+		if err != nil {
+			continue
+		}
+		if best == nil || best.LessThan(parsed) {
+			best, bestRelease = parsed, e.Version
+		}
+	}
+	return bestRelease
+}
@@ -0,0 +1,193 @@
+package kubeversion
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/snapshot"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot/snapshottest"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	flowcontrolv1 "k8s.io/api/flowcontrol/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		ops        func(t *testing.T) []snapshottest.Op
+		want       string
+		wantSource string
+		wantExact  bool
+		wantErr    error
+	}{
+		{
+			name: "kubeadm config wins over nodes",
+			ops: func(t *testing.T) []snapshottest.Op {
+				return []snapshottest.Op{
+					snapshottest.Put("/registry/configmaps/kube-system/kubeadm-config", snapshottest.Protobuf(t, &corev1.ConfigMap{
+						TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+						ObjectMeta: metav1.ObjectMeta{Name: "kubeadm-config", Namespace: "kube-system"},
+						Data:       map[string]string{"ClusterConfiguration": "apiVersion: kubeadm.k8s.io/v1beta3\nkind: ClusterConfiguration\nkubernetesVersion: v1.28.2\n"},
+					})),
+					snapshottest.Put("/registry/minions/node-1", node(t, "node-1", "v1.27.9", true)),
+				}
+			},
+			want:       "v1.28.2",
+			wantSource: SourceKubeadmConfig,
+			wantExact:  true,
+		},
+		{
+			name: "control plane kubelets of an rke2 cluster",
+			ops: func(t *testing.T) []snapshottest.Op {
+				return []snapshottest.Op{
+					snapshottest.Put("/registry/minions/server-1", rke2Node(t, "server-1", "v1.29.4+rke2r1", true)),
+					snapshottest.Put("/registry/minions/server-2", rke2Node(t, "server-2", "v1.29.3+rke2r1", true)),
+					snapshottest.Put("/registry/minions/agent-1", rke2Node(t, "agent-1", "v1.30.0+rke2r1", false)),
+					// RKE2 records its etcd snapshots, but not the cluster version, in ConfigMaps
+					snapshottest.Put("/registry/configmaps/kube-system/rke2-etcd-snapshots", snapshottest.Protobuf(t, &corev1.ConfigMap{
+						TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+						ObjectMeta: metav1.ObjectMeta{Name: "rke2-etcd-snapshots", Namespace: "kube-system"},
+					})),
+				}
+			},
+			want:       "v1.29.4",
+			wantSource: SourceNode,
+			wantExact:  true,
+		},
+		{
+			name: "worker kubelets without control plane labels",
+			ops: func(t *testing.T) []snapshottest.Op {
+				return []snapshottest.Op{
+					snapshottest.Put("/registry/minions/agent-1", node(t, "agent-1", "v1.26.1+k3s1", false)),
+					snapshottest.Put("/registry/minions/agent-2", node(t, "agent-2", "v1.26.10+k3s1", false)),
+				}
+			},
+			want:       "v1.26.10",
+			wantSource: SourceNode,
+			wantExact:  true,
+		},
+		{
+			name: "stored API versions give a lower bound",
+			ops: func(t *testing.T) []snapshottest.Op {
+				return []snapshottest.Op{
+					snapshottest.Put("/registry/flowschemas/exempt", snapshottest.Protobuf(t, &flowcontrolv1.FlowSchema{
+						TypeMeta:   metav1.TypeMeta{APIVersion: "flowcontrol.apiserver.k8s.io/v1", Kind: "FlowSchema"},
+						ObjectMeta: metav1.ObjectMeta{Name: "exempt"},
+					})),
+					snapshottest.Put("/registry/horizontalpodautoscalers/default/web", snapshottest.Protobuf(t, &autoscalingv2.HorizontalPodAutoscaler{
+						TypeMeta:   metav1.TypeMeta{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler"},
+						ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+					})),
+				}
+			},
+			want:       "v1.29.0",
+			wantSource: SourceStoredAPI,
+		},
+		{
+			name: "no evidence",
+			ops: func(t *testing.T) []snapshottest.Op {
+				return []snapshottest.Op{snapshottest.Put("/registry/namespaces/default", []byte("{}"))}
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap, err := snapshot.Open(snapshottest.Write(t, tt.ops(t)...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer snap.Close()
+
+			result, err := Detect(snap)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Detect() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Detect: %v", err)
+			}
+			if result.Version != tt.want || result.Source != tt.wantSource || result.Exact != tt.wantExact {
+				t.Errorf("Detect() = %s from %s (exact %v), want %s from %s (exact %v)",
+					result.Version, result.Source, result.Exact, tt.want, tt.wantSource, tt.wantExact)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"v1.28.5":         "v1.28.5",
+		"v1.29.4+rke2r1":  "v1.29.4",
+		"1.27.3+k3s1":     "v1.27.3",
+		"v1.30.0-eks-123": "v1.30.0",
+	}
+	for in, want := range tests {
+		got, err := Normalize(in)
+		if err != nil {
+			t.Fatalf("Normalize(%q): %v", in, err)
+		}
+		if got != want {
+			t.Errorf("Normalize(%q) = %s, want %s", in, got, want)
+		}
+	}
+
+	if _, err := Normalize("latest"); err == nil {
+		t.Error("expected error for non-version")
+	}
+}
+
+func TestImage(t *testing.T) {
+	tests := map[string]string{
+		"registry.k8s.io/kube-apiserver:v1.27.1":                     "registry.k8s.io/kube-apiserver:v1.29.4",
+		"mirror.example.com:5000/kube-apiserver":                     "mirror.example.com:5000/kube-apiserver:v1.29.4",
+		"registry.k8s.io/kube-apiserver@sha256:0123456789abcdef0123": "registry.k8s.io/kube-apiserver:v1.29.4",
+	}
+	for in, want := range tests {
+		if got := Image(in, "v1.29.4"); got != want {
+			t.Errorf("Image(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+// node encodes a Node with the given kubelet version.
+func node(t *testing.T, name, kubeletVersion string, controlPlane bool) []byte {
+	t.Helper()
+
+	n := &corev1.Node{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Node"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+		Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{KubeletVersion: kubeletVersion}},
+	}
+	if controlPlane {
+		n.Labels["node-role.kubernetes.io/control-plane"] = "true"
+	}
+	return snapshottest.Protobuf(t, n)
+}
+
+// rke2Node encodes a Node labelled and annotated like the RKE2 servers and agents.
+func rke2Node(t *testing.T, name, kubeletVersion string, server bool) []byte {
+	t.Helper()
+
+	n := &corev1.Node{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Node"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{"node.kubernetes.io/instance-type": "rke2"},
+			Annotations: map[string]string{"rke2.io/node-args": `["server"]`},
+		},
+		Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{KubeletVersion: kubeletVersion}},
+	}
+	if server {
+		n.Labels["node-role.kubernetes.io/control-plane"] = "true"
+		n.Labels["node-role.kubernetes.io/etcd"] = "true"
+		n.Labels["node-role.kubernetes.io/master"] = "true"
+	} else {
+		n.Annotations["rke2.io/node-args"] = `["agent"]`
+	}
+	return snapshottest.Protobuf(t, n)
+}
@@ -0,0 +1,169 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// scheme prefixes snapshot arguments stored in object storage.
+const scheme = "s3://"
+
+// DefaultEndpoint is used when no endpoint is configured.
+const DefaultEndpoint = "s3.amazonaws.com"
+
+// Options configures access to an S3-compatible endpoint such as AWS S3 or MinIO.
+type Options struct {
+	// Endpoint is a host[:port] or URL; an http:// URL disables TLS.
+	Endpoint string
+	Region   string
+	// AccessKey and SecretKey default to the AWS/MinIO environment variables and ~/.aws/credentials.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+}
+
+// Object is a snapshot stored in a bucket.
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Client reads snapshots from an S3-compatible bucket.
+type Client struct {
+	client *minio.Client
+}
+
+// IsURL reports whether a snapshot argument refers to object storage.
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, scheme)
+}
+
+// ParseURL splits an s3://bucket/key URL into its bucket and key.
+func ParseURL(s string) (string, string, error) {
+	if !IsURL(s) {
+		return "", "", fmt.Errorf("%q is not an s3:// URL", s)
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(s, scheme), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("s3 URL %q has no bucket", s)
+	}
+	return bucket, key, nil
+}
+
+// NewClient creates a client for the configured endpoint.
+func NewClient(opts Options) (*Client, error) {
+	endpoint, secure, err := parseEndpoint(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 transport: %v", err)
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read S3 CA file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in S3 CA file %s", opts.CAFile)
+		}
+		// Plain http endpoints get a transport without TLS configuration
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:     newCredentials(opts),
+		Secure:    secure,
+		Region:    opts.Region,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client for %s: %v", endpoint, err)
+	}
+	return &Client{client: client}, nil
+}
+
+// List returns the objects under a prefix, newest first.
+func (c *Client) List(ctx context.Context, bucket, prefix string) ([]Object, error) {
+	var objects []Object
+	for info := range c.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("failed to list s3://%s/%s: %v", bucket, prefix, info.Err)
+		}
+		if strings.HasSuffix(info.Key, "/") {
+			continue
+		}
+		objects = append(objects, Object{Key: info.Key, Size: info.Size, LastModified: info.LastModified})
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool { return objects[i].LastModified.After(objects[j].LastModified) })
+	return objects, nil
+}
+
+// Download writes an object to a local file.
+func (c *Client) Download(ctx context.Context, bucket, key, path string) error {
+	if err := c.client.FGetObject(ctx, bucket, key, path, minio.GetObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to download s3://%s/%s: %v", bucket, key, err)
+	}
+	return nil
+}
+
+// parseEndpoint returns the host and whether TLS is used.
+func parseEndpoint(endpoint string) (string, bool, error) {
+	if endpoint == "" {
+		return DefaultEndpoint, true, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, true, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid S3 endpoint %q: %v", endpoint, err)
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host, true, nil
+	case "http":
+		return u.Host, false, nil
+	default:
+		return "", false, fmt.Errorf("invalid S3 endpoint %q: scheme must be http or https", endpoint)
+	}
+}
+
+// newCredentials uses explicit keys when given and otherwise falls back to the
+// usual environment variables, shared credentials file and instance role.
+func newCredentials(opts Options) *credentials.Credentials {
+	if opts.AccessKey != "" || opts.SecretKey != "" {
+		return credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, opts.SessionToken)
+	}
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+}
@@ -0,0 +1,184 @@
+package s3
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal stand-in for MinIO serving ListObjectsV2, HEAD and GET.
+type fakeS3 struct {
+	bucket  string
+	objects map[string]string
+	times   map[string]time.Time
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/"+f.bucket)
+	if r.URL.Query().Get("list-type") == "2" {
+		prefix := r.URL.Query().Get("prefix")
+		var contents strings.Builder
+		for key, body := range f.objects {
+			if strings.HasPrefix(key, prefix) {
+				fmt.Fprintf(&contents, "<Contents><Key>%s</Key><LastModified>%s</LastModified><Size>%d</Size><ETag>\"etag\"</ETag></Contents>",
+					key, f.times[key].UTC().Format(time.RFC3339), len(body))
+			}
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><Name>%s</Name><Prefix>%s</Prefix><KeyCount>%d</KeyCount><MaxKeys>1000</MaxKeys><IsTruncated>false</IsTruncated>%s</ListBucketResult>`,
+			f.bucket, prefix, len(f.objects), contents.String())
+		return
+	}
+
+	body, ok := f.objects[strings.TrimPrefix(path, "/")]
+	if !ok {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>missing</Message></Error>`)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", `"etag"`)
+	if r.Method == http.MethodHead {
+		return
+	}
+	fmt.Fprint(w, body)
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	now := time.Now()
+	server := httptest.NewServer(&fakeS3{
+		bucket: "backups",
+		objects: map[string]string{
+			"rke2/etcd-snapshot-server-1-1700000000.zip": "older",
+			"rke2/etcd-snapshot-server-1-1700003600.zip": "newer!",
+			"other/file": "x",
+		},
+		times: map[string]time.Time{
+			"rke2/etcd-snapshot-server-1-1700000000.zip": now.Add(-2 * time.Hour),
+			"rke2/etcd-snapshot-server-1-1700003600.zip": now.Add(-time.Hour),
+			"other/file": now,
+		},
+	})
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(Options{Endpoint: server.URL, Region: "us-east-1", AccessKey: "minio", SecretKey: "minio123"})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestList(t *testing.T) {
+	client := newTestClient(t)
+
+	objects, err := client.List(context.Background(), "backups", "rke2/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("expected 2 objects, got %+v", objects)
+	}
+	if objects[0].Key != "rke2/etcd-snapshot-server-1-1700003600.zip" || objects[0].Size != 6 {
+		t.Errorf("expected newest snapshot first, got %+v", objects)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	client := newTestClient(t)
+	path := filepath.Join(t.TempDir(), "snapshot.zip")
+
+	if err := client.Download(context.Background(), "backups", "rke2/etcd-snapshot-server-1-1700003600.zip", path); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "newer!" {
+		t.Errorf("downloaded %q, want %q", data, "newer!")
+	}
+
+	err = client.Download(context.Background(), "backups", "rke2/missing.zip", filepath.Join(t.TempDir(), "missing"))
+	if err == nil || !strings.Contains(err.Error(), "s3://backups/rke2/missing.zip") {
+		t.Errorf("expected download error naming the object, got %v", err)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url        string
+		wantBucket string
+		wantKey    string
+		wantErr    bool
+	}{
+		{url: "s3://backups/rke2/snap.zip", wantBucket: "backups", wantKey: "rke2/snap.zip"},
+		{url: "s3://backups", wantBucket: "backups"},
+		{url: "s3:///key", wantErr: true},
+		{url: "/tmp/snapshot.db", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		bucket, key, err := ParseURL(tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			continue
+		}
+		if bucket != tt.wantBucket || key != tt.wantKey {
+			t.Errorf("ParseURL(%q) = %q, %q, want %q, %q", tt.url, bucket, key, tt.wantBucket, tt.wantKey)
+		}
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint   string
+		wantHost   string
+		wantSecure bool
+	}{
+		{endpoint: "", wantHost: DefaultEndpoint, wantSecure: true},
+		{endpoint: "minio.lab:9000", wantHost: "minio.lab:9000", wantSecure: true},
+		{endpoint: "http://127.0.0.1:9000", wantHost: "127.0.0.1:9000"},
+		{endpoint: "https://s3.example.com", wantHost: "s3.example.com", wantSecure: true},
+	}
+
+	for _, tt := range tests {
+		host, secure, err := parseEndpoint(tt.endpoint)
+		if err != nil {
+			t.Fatalf("parseEndpoint(%q): %v", tt.endpoint, err)
+		}
+		if host != tt.wantHost || secure != tt.wantSecure {
+			t.Errorf("parseEndpoint(%q) = %s, %v, want %s, %v", tt.endpoint, host, secure, tt.wantHost, tt.wantSecure)
+		}
+	}
+}
+
+func TestNewClientCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, endpoint := range []string{"http://127.0.0.1:1", "https://127.0.0.1:1"} {
+		if _, err := NewClient(Options{Endpoint: endpoint, AccessKey: "minio", SecretKey: "minio123", CAFile: caFile}); err != nil {
+			t.Errorf("NewClient(%s) with a CA file: %v", endpoint, err)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Package session keeps track of named sets of containers, volumes and ports so
+// that several snapshots can be restored and served side by side.
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/supporttools/snapshot-insight/pkg/etcd"
+)
+
+// DefaultName is the session used when none is selected. It keeps the historical
+// container names, volume names and ports.
+const DefaultName = "default"
+
+// namePattern restricts session names to what is valid in container and volume names.
+var namePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,38}[a-z0-9])?$`)
+
+// ErrNotFound is returned when a session does not exist.
+var ErrNotFound = errors.New("session not found")
+
+// Session is the state of one named session.
+type Session struct {
+	Name string `json:"name"`
+
+	EtcdContainer      string `json:"etcdContainer"`
+	APIServerContainer string `json:"apiServerContainer"`
+	EtcdVolume         string `json:"etcdVolume"`
+	CertsVolume        string `json:"certsVolume"`
+
+	Ports   etcd.Ports   `json:"ports"`
+	Network etcd.Network `json:"network"`
+	// EtcdTLS records whether etcd was last started with --etcd-tls.
+	EtcdTLS bool `json:"etcdTLS,omitempty"`
+
+	// ReadOnly is set when kube-apiserver was started in read-only mode, so that
+	// kubeconfigs use the viewer credentials.
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// PKIDir holds the certificates generated by start, when not the pki directory of
+	// the session.
+	PKIDir string `json:"pkiDir,omitempty"`
+
+	// Snapshot is the snapshot last restored into the session.
+	Snapshot  string    `json:"snapshot,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Store persists sessions in a state directory. Each session has its own
+// directory holding its state and the files generated for it.
+type Store struct {
+	Dir string
+}
+
+// DefaultDir returns $SNAPSHOT_INSIGHT_HOME, or ~/.snapshot-insight.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv("SNAPSHOT_INSIGHT_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %v", err)
+	}
+	return filepath.Join(home, ".snapshot-insight"), nil
+}
+
+// ValidateName checks that a session name can be used in container and volume names.
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid session name %q: use up to 40 lowercase letters, digits and dashes", name)
+	}
+	return nil
+}
+
+// Get loads a session.
+func (s *Store) Get(name string) (*Session, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %v", name, err)
+	}
+
+	sess := &Session{}
+	if err := json.Unmarshal(data, sess); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %v", name, err)
+	}
+	return sess, nil
+}
+
+// GetOrCreate loads a session, allocating and saving a new one if it does not exist.
+func (s *Store) GetOrCreate(name string) (*Session, bool, error) {
+	sess, err := s.Get(name)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return sess, false, err
+	}
+
+	if sess, err = s.allocate(name); err != nil {
+		return nil, false, err
+	}
+	if err := s.Save(sess); err != nil {
+		return nil, false, err
+	}
+	return sess, true, nil
+}
+
+// List returns all sessions sorted by name.
+func (s *Store) List() ([]*Session, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, "sessions"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		sess, err := s.Get(entry.Name())
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name < sessions[j].Name })
+	return sessions, nil
+}
+
+// Save writes a session to disk.
+func (s *Store) Save(sess *Session) error {
+	if err := ValidateName(sess.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.SessionDir(sess.Name), 0o700); err != nil {
+		return fmt.Errorf("failed to create session directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session %s: %v", sess.Name, err)
+	}
+	if err := os.WriteFile(s.path(sess.Name), append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write session %s: %v", sess.Name, err)
+	}
+	return nil
+}
+
+// Remove deletes the directory of a session. It is not an error if it does not exist.
+func (s *Store) Remove(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(s.SessionDir(name)); err != nil {
+		return fmt.Errorf("failed to remove session %s: %v", name, err)
+	}
+
+	if current, _ := s.Current(); current == name {
+		return s.Use(DefaultName)
+	}
+	return nil
+}
+
+// Current returns the name of the session selected with Use, or DefaultName.
+func (s *Store) Current() (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir, "current"))
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultName, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read current session: %v", err)
+	}
+
+	name := strings.TrimSpace(string(data))
+	if name == "" {
+		return DefaultName, nil
+	}
+	return name, ValidateName(name)
+}
+
+// Use makes name the current session.
+func (s *Store) Use(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.Dir, "current"), []byte(name+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to write current session: %v", err)
+	}
+	return nil
+}
+
+// SessionDir returns the directory of a session.
+func (s *Store) SessionDir(name string) string {
+	return filepath.Join(s.Dir, "sessions", name)
+}
+
+// PKIDir returns the directory holding the certificates of a session.
+func (s *Store) PKIDir(sess *Session) string {
+	if sess.PKIDir != "" {
+		return sess.PKIDir
+	}
+	return filepath.Join(s.SessionDir(sess.Name), "pki")
+}
+
+// path returns the state file of a session.
+func (s *Store) path(name string) string {
+	return filepath.Join(s.SessionDir(name), "session.json")
+}
+
+// allocate builds a new session. The default session keeps the historical names and
+// ports; other sessions get prefixed names and free ports not used by other sessions.
+func (s *Store) allocate(name string) (*Session, error) {
+	if name == DefaultName {
+		return &Session{
+			Name:               name,
+			EtcdContainer:      etcd.DefaultEtcdContainerName,
+			APIServerContainer: etcd.DefaultKubeAPIServerContainerName,
+			EtcdVolume:         etcd.DefaultEtcdVolumeName,
+			CertsVolume:        etcd.DefaultCertsVolumeName,
+			Ports:              etcd.DefaultPorts(),
+			Network:            etcd.DefaultNetwork(),
+			CreatedAt:          time.Now().UTC(),
+		}, nil
+	}
+
+	existing, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	// The default ports stay reserved for the default session even before it exists
+	defaults := etcd.DefaultPorts()
+	used := map[int]bool{defaults.EtcdClient: true, defaults.EtcdPeer: true, defaults.KubeAPIServer: true}
+	for _, other := range existing {
+		used[other.Ports.EtcdClient] = true
+		used[other.Ports.EtcdPeer] = true
+		used[other.Ports.KubeAPIServer] = true
+	}
+
+	var ports [3]int
+	for i := range ports {
+		if ports[i], err = freePort(used); err != nil {
+			return nil, err
+		}
+		used[ports[i]] = true
+	}
+
+	prefix := networkName(name)
+	return &Session{
+		Name:               name,
+		EtcdContainer:      prefix + "-etcd",
+		APIServerContainer: prefix + "-kube-apiserver",
+		EtcdVolume:         prefix + "-etcd-data",
+		CertsVolume:        prefix + "-certs",
+		Ports:              etcd.Ports{EtcdClient: ports[0], EtcdPeer: ports[1], KubeAPIServer: ports[2]},
+		Network:            etcd.Network{Mode: etcd.NetworkBridge, Name: networkName(name)},
+		CreatedAt:          time.Now().UTC(),
+	}, nil
+}
+
+// networkName returns the dedicated network of a session.
+func networkName(name string) string {
+	if name == DefaultName {
+		return etcd.DefaultNetworkName
+	}
+	return "snapshot-insight-" + name
+}
+
+// freePort asks the kernel for a free TCP port that is not in used.
+func freePort(used map[int]bool) (int, error) {
+	for attempt := 0; attempt < 20; attempt++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, fmt.Errorf("failed to find a free port: %v", err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		if !used[port] {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("failed to find a free port not used by another session")
+}
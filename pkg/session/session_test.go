@@ -0,0 +1,126 @@
+package session
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/etcd"
+)
+
+func TestGetOrCreate(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+
+	def, created, err := store.GetOrCreate(DefaultName)
+	if err != nil || !created {
+		t.Fatalf("GetOrCreate(default) = %v, %v", created, err)
+	}
+	if def.EtcdContainer != etcd.DefaultEtcdContainerName || def.Ports != etcd.DefaultPorts() || def.Network != etcd.DefaultNetwork() {
+		t.Errorf("default session does not keep the standard names and ports: %+v", def)
+	}
+
+	a, _, err := store.GetOrCreate("customer-a")
+	if err != nil {
+		t.Fatalf("GetOrCreate(customer-a): %v", err)
+	}
+	b, _, err := store.GetOrCreate("customer-b")
+	if err != nil {
+		t.Fatalf("GetOrCreate(customer-b): %v", err)
+	}
+	if a.EtcdContainer != "snapshot-insight-customer-a-etcd" || a.CertsVolume != "snapshot-insight-customer-a-certs" || a.Network.Name != "snapshot-insight-customer-a" {
+		t.Errorf("unexpected names: %+v", a)
+	}
+
+	seen := map[int]string{}
+	for _, sess := range []*Session{def, a, b} {
+		for _, port := range []int{sess.Ports.EtcdClient, sess.Ports.EtcdPeer, sess.Ports.KubeAPIServer} {
+			if other, ok := seen[port]; ok {
+				t.Errorf("port %d allocated to both %s and %s", port, other, sess.Name)
+			}
+			seen[port] = sess.Name
+		}
+	}
+
+	again, created, err := store.GetOrCreate("customer-a")
+	if err != nil || created {
+		t.Fatalf("GetOrCreate(existing) = %v, %v", created, err)
+	}
+	if !reflect.DeepEqual(again.Ports, a.Ports) {
+		t.Errorf("reloaded ports %+v, want %+v", again.Ports, a.Ports)
+	}
+
+	sessions, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var names []string
+	for _, sess := range sessions {
+		names = append(names, sess.Name)
+	}
+	if want := []string{"customer-a", "customer-b", "default"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %v, want %v", names, want)
+	}
+}
+
+func TestPKIDir(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+	sess, _, err := store.GetOrCreate("customer-a")
+	if err != nil {
+		t.Fatalf("GetOrCreate: %v", err)
+	}
+	if got, want := store.PKIDir(sess), filepath.Join(store.SessionDir("customer-a"), "pki"); got != want {
+		t.Errorf("PKIDir = %s, want %s", got, want)
+	}
+
+	sess.PKIDir = "/srv/pki"
+	if got := store.PKIDir(sess); got != "/srv/pki" {
+		t.Errorf("PKIDir = %s, want /srv/pki", got)
+	}
+}
+
+func TestUseAndRemove(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+
+	if current, err := store.Current(); err != nil || current != DefaultName {
+		t.Fatalf("Current() = %s, %v, want default", current, err)
+	}
+	if _, _, err := store.GetOrCreate("old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Use("old"); err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+	if current, _ := store.Current(); current != "old" {
+		t.Errorf("Current() = %s, want old", current)
+	}
+
+	if err := store.Remove("old"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := store.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(removed) error = %v, want ErrNotFound", err)
+	}
+	if current, _ := store.Current(); current != DefaultName {
+		t.Errorf("Current() after removing it = %s, want default", current)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"default":    true,
+		"customer-a": true,
+		"2024-10-16": true,
+		"":           false,
+		"Customer":   false,
+		"-leading":   false,
+		"trailing-":  false,
+		"../escape":  false,
+		"with space": false,
+		"a-very-long-session-name-that-goes-on-forever": false,
+	} {
+		if err := ValidateName(name); (err == nil) != valid {
+			t.Errorf("ValidateName(%q) = %v, want valid=%v", name, err, valid)
+		}
+	}
+}
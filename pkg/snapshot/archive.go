@@ -0,0 +1,329 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxUnwrapDepth bounds nested wrappers such as a zip inside a tarball.
+const maxUnwrapDepth = 5
+
+// format is a snapshot wrapper recognised by its magic bytes.
+type format string
+
+const (
+	formatRaw  format = "raw"
+	formatGzip format = "gzip"
+	formatZstd format = "zstd"
+	formatZip  format = "zip"
+	formatTar  format = "tar"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte("PK\x03\x04")
+	tarMagic  = []byte("ustar")
+)
+
+// tarMagicOffset is where the ustar magic lives in a tar header block.
+const tarMagicOffset = 257
+
+// metadataExtensions are archive members that never hold the database.
+var metadataExtensions = []string{".json", ".yaml", ".yml", ".txt", ".md", ".log", ".sha256", ".sig"}
+
+// Prepared is a snapshot unwrapped into a plain database file.
+type Prepared struct {
+	// Path is the raw database file; it equals the input when no unwrapping was needed.
+	Path string
+	// Steps describes each wrapper that was removed, outermost first.
+	Steps []string
+
+	tempDir string
+}
+
+// Prepare detects gzip, zstd, zip and tar wrappers around a snapshot, including
+// RKE2/k3s zip uploads and support bundle tarballs, and streams the database
+// into a temporary file. Close removes any temporary files.
+func Prepare(snapshotPath string) (*Prepared, error) {
+	prepared := &Prepared{Path: snapshotPath}
+
+	for depth := 0; ; depth++ {
+		f, err := detect(prepared.Path)
+		if err != nil {
+			prepared.Close()
+			return nil, err
+		}
+		if f == formatRaw {
+			return prepared, nil
+		}
+		if depth == maxUnwrapDepth {
+			prepared.Close()
+			return nil, fmt.Errorf("snapshot %s is wrapped more than %d levels deep", snapshotPath, maxUnwrapDepth)
+		}
+
+		if prepared.tempDir == "" {
+			if prepared.tempDir, err = os.MkdirTemp("", "snapshot-insight-"); err != nil {
+				return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+			}
+		}
+
+		step, err := prepared.unwrap(f, depth)
+		if err != nil {
+			prepared.Close()
+			return nil, fmt.Errorf("failed to unpack %s: %v", snapshotPath, err)
+		}
+		prepared.Steps = append(prepared.Steps, step)
+	}
+}
+
+// Close removes the temporary files created while unwrapping.
+func (p *Prepared) Close() error {
+	if p.tempDir == "" {
+		return nil
+	}
+	return os.RemoveAll(p.tempDir)
+}
+
+// unwrap removes one wrapper from the current file and points Path at the result.
+func (p *Prepared) unwrap(f format, depth int) (string, error) {
+	src := p.Path
+	dst := filepath.Join(p.tempDir, fmt.Sprintf("layer-%d", depth))
+
+	switch f {
+	case formatGzip:
+		return fmt.Sprintf("decompressed gzip %s", filepath.Base(src)), p.decompress(src, dst, func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		})
+	case formatZstd:
+		return fmt.Sprintf("decompressed zstd %s", filepath.Base(src)), p.decompress(src, dst, func(r io.Reader) (io.ReadCloser, error) {
+			decoder, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return decoder.IOReadCloser(), nil
+		})
+	case formatZip:
+		member, err := extractZip(src, dst)
+		if err != nil {
+			return "", err
+		}
+		p.Path = dst
+		return fmt.Sprintf("extracted %s from zip %s", member, filepath.Base(src)), nil
+	case formatTar:
+		member, err := extractTar(src, dst)
+		if err != nil {
+			return "", err
+		}
+		p.Path = dst
+		return fmt.Sprintf("extracted %s from tar %s", member, filepath.Base(src)), nil
+	default:
+		return "", fmt.Errorf("unsupported format %s", f)
+	}
+}
+
+// decompress streams src through a decompressor into dst.
+func (p *Prepared) decompress(src, dst string, newReader func(io.Reader) (io.ReadCloser, error)) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	r, err := newReader(in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := writeFile(dst, r); err != nil {
+		return err
+	}
+	p.Path = dst
+	return nil
+}
+
+// detect identifies the wrapper of a file from its leading bytes.
+func detect(path string) (format, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open snapshot %s: %v", path, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, tarMagicOffset+len(tarMagic))
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read snapshot %s: %v", path, err)
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return formatGzip, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		return formatZstd, nil
+	case bytes.HasPrefix(header, zipMagic):
+		return formatZip, nil
+	case len(header) == tarMagicOffset+len(tarMagic) && bytes.Equal(header[tarMagicOffset:], tarMagic):
+		return formatTar, nil
+	default:
+		return formatRaw, nil
+	}
+}
+
+// memberScore ranks archive members: named snapshots and .db files first, then
+// nested archives, then anything else. Metadata files are never picked.
+func memberScore(name string) int {
+	if IsMetadataFile(name) {
+		return -1
+	}
+
+	base := strings.ToLower(path.Base(name))
+	switch {
+	case strings.HasSuffix(base, ".db") || strings.Contains(base, "snapshot"):
+		return 2
+	case strings.HasSuffix(base, ".gz") || strings.HasSuffix(base, ".zst") || strings.HasSuffix(base, ".zip") || strings.HasSuffix(base, ".tar"):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// IsMetadataFile reports whether a file name looks like snapshot metadata, such
+// as the .json sidecar RKE2 uploads next to each snapshot, rather than a database.
+func IsMetadataFile(name string) bool {
+	base := strings.ToLower(path.Base(name))
+	for _, ext := range metadataExtensions {
+		if strings.HasSuffix(base, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// better reports whether a member beats the current best pick, preferring the
+// highest score and then the largest file.
+func better(name string, size int64, bestName string, bestSize int64) bool {
+	score := memberScore(name)
+	if score < 0 {
+		return false
+	}
+	if bestName == "" {
+		return true
+	}
+	if bestScore := memberScore(bestName); score != bestScore {
+		return score > bestScore
+	}
+	return size > bestSize
+}
+
+// extractZip writes the best database candidate of a zip archive to dst.
+func extractZip(src, dst string) (string, error) {
+	archive, err := zip.OpenReader(src)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	var best *zip.File
+	for _, member := range archive.File {
+		if member.FileInfo().IsDir() {
+			continue
+		}
+		var bestName string
+		var bestSize int64
+		if best != nil {
+			bestName, bestSize = best.Name, int64(best.UncompressedSize64)
+		}
+		if better(member.Name, int64(member.UncompressedSize64), bestName, bestSize) {
+			best = member
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("zip archive contains no snapshot")
+	}
+
+	r, err := best.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	return best.Name, writeFile(dst, r)
+}
+
+// extractTar writes the best database candidate of a tar archive to dst. The
+// archive is read twice: once to pick the member and once to stream it.
+func extractTar(src, dst string) (string, error) {
+	var bestName string
+	var bestSize int64
+	err := walkTar(src, func(header *tar.Header, _ io.Reader) (bool, error) {
+		if header.Typeflag == tar.TypeReg && better(header.Name, header.Size, bestName, bestSize) {
+			bestName, bestSize = header.Name, header.Size
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if bestName == "" {
+		return "", fmt.Errorf("tar archive contains no snapshot")
+	}
+
+	err = walkTar(src, func(header *tar.Header, r io.Reader) (bool, error) {
+		if header.Name != bestName {
+			return false, nil
+		}
+		return true, writeFile(dst, r)
+	})
+	return bestName, err
+}
+
+// walkTar calls fn for each member until it returns true or the archive ends.
+func walkTar(src string, fn func(header *tar.Header, r io.Reader) (bool, error)) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive := tar.NewReader(file)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		done, err := fn(header, archive)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// writeFile streams r into a new file at path.
+func writeFile(path string, r io.Reader) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,187 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/supporttools/snapshot-insight/pkg/snapshot/snapshottest"
+)
+
+func TestPrepare(t *testing.T) {
+	db, err := os.ReadFile(snapshottest.Write(t, snapshottest.Put("/registry/namespaces/default", []byte("{}"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		wrap      func(t *testing.T) []byte
+		wantSteps []string
+	}{
+		{
+			name: "raw",
+			wrap: func(t *testing.T) []byte { return db },
+		},
+		{
+			name:      "gzip",
+			wrap:      func(t *testing.T) []byte { return gzipBytes(t, db) },
+			wantSteps: []string{"decompressed gzip"},
+		},
+		{
+			name:      "zstd",
+			wrap:      func(t *testing.T) []byte { return zstdBytes(t, db) },
+			wantSteps: []string{"decompressed zstd"},
+		},
+		{
+			name: "rke2 zip upload",
+			wrap: func(t *testing.T) []byte {
+				return zipBytes(t, map[string][]byte{
+					"etcd-snapshot-server-1-1700000000":      db,
+					"etcd-snapshot-server-1-1700000000.json": []byte(`{"name":"etcd-snapshot-server-1-1700000000"}`),
+				})
+			},
+			wantSteps: []string{"extracted etcd-snapshot-server-1-1700000000 from zip"},
+		},
+		{
+			name: "support bundle tarball",
+			wrap: func(t *testing.T) []byte {
+				return gzipBytes(t, tarBytes(t, map[string][]byte{
+					"bundle/logs/kubelet.log":           bytes.Repeat([]byte("log line\n"), 10000),
+					"bundle/etcd/snapshot.db":           db,
+					"bundle/etcd/snapshot-metadata.txt": []byte("revision 2"),
+				}))
+			},
+			wantSteps: []string{"decompressed gzip", "extracted bundle/etcd/snapshot.db from tar"},
+		},
+		{
+			name: "zstd inside tar",
+			wrap: func(t *testing.T) []byte {
+				return tarBytes(t, map[string][]byte{"backup/etcd.db.zst": zstdBytes(t, db)})
+			},
+			wantSteps: []string{"extracted backup/etcd.db.zst from tar", "decompressed zstd"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "input")
+			if err := os.WriteFile(path, tt.wrap(t), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			prepared, err := Prepare(path)
+			if err != nil {
+				t.Fatalf("Prepare: %v", err)
+			}
+			defer prepared.Close()
+
+			if len(prepared.Steps) != len(tt.wantSteps) {
+				t.Fatalf("Steps = %q, want %q", prepared.Steps, tt.wantSteps)
+			}
+			for i, want := range tt.wantSteps {
+				if !strings.HasPrefix(prepared.Steps[i], want) {
+					t.Errorf("Steps[%d] = %q, want prefix %q", i, prepared.Steps[i], want)
+				}
+			}
+
+			got, err := os.ReadFile(prepared.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, db) {
+				t.Errorf("prepared database differs from the original (%d vs %d bytes)", len(got), len(db))
+			}
+
+			if err := prepared.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.wantSteps) > 0 {
+				if _, err := os.Stat(prepared.Path); !os.IsNotExist(err) {
+					t.Errorf("temporary file %s was not removed", prepared.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareArchiveWithoutSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.zip")
+	if err := os.WriteFile(path, zipBytes(t, map[string][]byte{"metadata.json": []byte("{}")}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Prepare(path); err == nil || !strings.Contains(err.Error(), "contains no snapshot") {
+		t.Fatalf("Prepare() error = %v, want no snapshot error", err)
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+	return encoder.EncodeAll(data, nil)
+}
+
+func zipBytes(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarBytes(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for name, data := range files {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
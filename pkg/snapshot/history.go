@@ -0,0 +1,80 @@
+package snapshot
+
+import (
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// metaBucket is the bbolt bucket holding the consistent index and compaction progress.
+var metaBucket = []byte("meta")
+
+// finishedCompactKey records the revision the last completed compaction was run at.
+var finishedCompactKey = []byte("finishedCompactRev")
+
+// KeysAt returns every key with the given prefix as it was at revision, sorted by key: the
+// latest revision of each key at or before revision, leaving out keys deleted by then.
+// Revisions before the last compaction are rejected, as etcd has discarded part of them.
+func (s *Snapshot) KeysAt(prefix string, revision int64) ([]KeyValue, error) {
+	if err := s.checkRevision(revision); err != nil {
+		return nil, err
+	}
+	return s.keysAt(hasPrefix(prefix), revision)
+}
+
+// History returns every revision of key still in the snapshot, oldest first. Deletions are
+// included as tombstones whose ModRevision is the revision of the deletion.
+func (s *Snapshot) History(key string) ([]KeyValue, error) {
+	var history []KeyValue
+	err := s.Walk(func(rev Revision, kv KeyValue) error {
+		if kv.Key != key {
+			return nil
+		}
+		if kv.Tombstone {
+			kv.ModRevision = rev.Main
+		}
+		history = append(history, kv)
+		return nil
+	})
+	return history, err
+}
+
+// CompactRevision returns the revision of the last completed compaction, or zero when the
+// snapshot was never compacted. Older revisions are only partially available.
+func (s *Snapshot) CompactRevision() (int64, error) {
+	var rev Revision
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(metaBucket)
+		if bucket == nil {
+			return nil
+		}
+		v := bucket.Get(finishedCompactKey)
+		if v == nil {
+			return nil
+		}
+		var err error
+		rev, _, err = parseRevisionKey(v)
+		return err
+	})
+	return rev.Main, err
+}
+
+// checkRevision returns an error unless revision lies between the last compaction and the
+// latest revision of the snapshot.
+func (s *Snapshot) checkRevision(revision int64) error {
+	latest, err := s.Revision()
+	if err != nil {
+		return err
+	}
+	if revision <= 0 || revision > latest {
+		return fmt.Errorf("revision %d is outside the snapshot, which ends at revision %d", revision, latest)
+	}
+	compacted, err := s.CompactRevision()
+	if err != nil {
+		return err
+	}
+	if revision < compacted {
+		return fmt.Errorf("revision %d has been compacted, the oldest complete revision is %d", revision, compacted)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/snapshot/snapshottest"
+)
+
+func TestKeysAt(t *testing.T) {
+	path := snapshottest.Write(t,
+		snapshottest.Put("/registry/configmaps/default/a", []byte("one")),   // 2
+		snapshottest.Put("/registry/configmaps/default/b", []byte("two")),   // 3
+		snapshottest.Put("/registry/configmaps/default/a", []byte("three")), // 4
+		snapshottest.Delete("/registry/configmaps/default/b"),               // 5
+	)
+
+	snap, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	tests := []struct {
+		revision int64
+		want     map[string]string
+	}{
+		{revision: 2, want: map[string]string{"/registry/configmaps/default/a": "one"}},
+		{revision: 3, want: map[string]string{"/registry/configmaps/default/a": "one", "/registry/configmaps/default/b": "two"}},
+		{revision: 4, want: map[string]string{"/registry/configmaps/default/a": "three", "/registry/configmaps/default/b": "two"}},
+		{revision: 5, want: map[string]string{"/registry/configmaps/default/a": "three"}},
+	}
+	for _, tt := range tests {
+		kvs, err := snap.KeysAt("/registry/configmaps/", tt.revision)
+		if err != nil {
+			t.Fatalf("KeysAt(%d): %v", tt.revision, err)
+		}
+		got := map[string]string{}
+		for _, kv := range kvs {
+			got[kv.Key] = string(kv.Value)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("KeysAt(%d) = %v, want %v", tt.revision, got, tt.want)
+			continue
+		}
+		for key, value := range tt.want {
+			if got[key] != value {
+				t.Errorf("KeysAt(%d) = %v, want %v", tt.revision, got, tt.want)
+			}
+		}
+	}
+
+	for _, revision := range []int64{0, 6} {
+		if _, err := snap.KeysAt("", revision); err == nil {
+			t.Errorf("expected an error for revision %d outside the snapshot", revision)
+		}
+	}
+}
+
+func TestKeysAtCompacted(t *testing.T) {
+	path := snapshottest.Write(t,
+		snapshottest.Put("/a", []byte("1")),
+		snapshottest.Put("/a", []byte("2")),
+		snapshottest.Put("/a", []byte("3")),
+	)
+	snapshottest.Compact(t, path, 3)
+
+	snap, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	compacted, err := snap.CompactRevision()
+	if err != nil || compacted != 3 {
+		t.Fatalf("CompactRevision() = %d, %v, want 3", compacted, err)
+	}
+	if _, err := snap.KeysAt("", 2); err == nil || err.Error() != "revision 2 has been compacted, the oldest complete revision is 3" {
+		t.Errorf("unexpected error for a compacted revision: %v", err)
+	}
+	if kvs, err := snap.KeysAt("", 3); err != nil || len(kvs) != 1 || string(kvs[0].Value) != "2" {
+		t.Errorf("KeysAt(3) = %+v, %v", kvs, err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := snapshottest.Write(t,
+		snapshottest.Put("/a", []byte("1")),
+		snapshottest.Put("/ab", []byte("other")),
+		snapshottest.Put("/a", []byte("2")),
+		snapshottest.Delete("/a"),
+		snapshottest.Put("/a", []byte("3")),
+	)
+
+	snap, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	history, err := snap.History("/a")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("expected 4 revisions of /a, got %+v", history)
+	}
+	wantRevisions := []int64{2, 4, 5, 6}
+	wantValues := []string{"1", "2", "", "3"}
+	for i, kv := range history {
+		if kv.ModRevision != wantRevisions[i] || string(kv.Value) != wantValues[i] || kv.Tombstone != (i == 2) {
+			t.Errorf("history[%d] = %+v, want revision %d with %q", i, kv, wantRevisions[i], wantValues[i])
+		}
+	}
+	if history[3].CreateRevision != 6 || history[3].Version != 1 {
+		t.Errorf("expected the recreated key to start over, got %+v", history[3])
+	}
+
+	compacted, err := snap.CompactRevision()
+	if err != nil || compacted != 0 {
+		t.Errorf("CompactRevision() = %d, %v, want 0 without compaction", compacted, err)
+	}
+}
@@ -0,0 +1,178 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// keyBucket is the bbolt bucket holding every MVCC revision of every key.
+var keyBucket = []byte("key")
+
+// revisionKeyLen is the length of a revision key: 8 bytes main, '_', 8 bytes sub.
+const revisionKeyLen = 17
+
+// tombstoneMarker is appended to revision keys recording a deletion.
+const tombstoneMarker = 't'
+
+// Revision identifies a single change in the etcd MVCC store.
+type Revision struct {
+	Main int64
+	Sub  int64
+}
+
+// KeyValue is a single revision of a key read from the snapshot.
+type KeyValue struct {
+	Key            string `json:"key"`
+	CreateRevision int64  `json:"createRevision"`
+	ModRevision    int64  `json:"modRevision"`
+	Version        int64  `json:"version"`
+	Lease          int64  `json:"lease,omitempty"`
+	Size           int    `json:"size"`
+	Tombstone      bool   `json:"tombstone,omitempty"`
+	Value          []byte `json:"-"`
+}
+
+// Snapshot is a read-only view of the bbolt database inside an etcd snapshot.
+type Snapshot struct {
+	path string
+	db   *bolt.DB
+}
+
+// Open opens an etcd snapshot read-only without starting etcd.
+func Open(path string) (*Snapshot, error) {
+	db, err := bolt.Open(path, 0o400, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot %s: %v", path, err)
+	}
+	return &Snapshot{path: path, db: db}, nil
+}
+
+// Close releases the snapshot file.
+func (s *Snapshot) Close() error {
+	return s.db.Close()
+}
+
+// Walk calls fn for every revision in the key bucket in revision order.
+func (s *Snapshot) Walk(fn func(rev Revision, kv KeyValue) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(keyBucket)
+		if bucket == nil {
+			return fmt.Errorf("snapshot %s has no %q bucket", s.path, keyBucket)
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			rev, tombstone, err := parseRevisionKey(k)
+			if err != nil {
+				return err
+			}
+
+			var pb mvccpb.KeyValue
+			if err := pb.Unmarshal(v); err != nil {
+				return fmt.Errorf("failed to decode revision %d_%d: %v", rev.Main, rev.Sub, err)
+			}
+
+			return fn(rev, KeyValue{
+				Key:            string(pb.Key),
+				CreateRevision: pb.CreateRevision,
+				ModRevision:    pb.ModRevision,
+				Version:        pb.Version,
+				Lease:          pb.Lease,
+				Size:           len(pb.Value),
+				Tombstone:      tombstone,
+				// bbolt memory is only valid inside the transaction
+				Value: bytes.Clone(pb.Value),
+			})
+		})
+	})
+}
+
+// Keys returns the latest live revision of every key with the given prefix, sorted by key.
+func (s *Snapshot) Keys(prefix string) ([]KeyValue, error) {
+	return s.keysAt(hasPrefix(prefix), 0)
+}
+
+// KeysWithPrefixes returns the latest live revision of every key with any of the given
+// prefixes, sorted by key, reading the snapshot once.
+func (s *Snapshot) KeysWithPrefixes(prefixes ...string) ([]KeyValue, error) {
+	return s.keysAt(hasPrefix(prefixes...), 0)
+}
+
+// hasPrefix returns a matcher for keys with any of the given prefixes.
+func hasPrefix(prefixes ...string) func(key string) bool {
+	return func(key string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// keysAt returns the live revision of every matching key as of revision, or the latest one
+// when revision is zero, sorted by key.
+func (s *Snapshot) keysAt(match func(key string) bool, revision int64) ([]KeyValue, error) {
+	latest := map[string]KeyValue{}
+	err := s.Walk(func(rev Revision, kv KeyValue) error {
+		if !match(kv.Key) || (revision > 0 && rev.Main > revision) {
+			return nil
+		}
+		// Revisions are visited in order, so the last one seen wins
+		if kv.Tombstone {
+			delete(latest, kv.Key)
+		} else {
+			latest[kv.Key] = kv
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := make([]KeyValue, 0, len(latest))
+	for _, kv := range latest {
+		kvs = append(kvs, kv)
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, nil
+}
+
+// Revision returns the latest revision recorded in the snapshot.
+func (s *Snapshot) Revision() (int64, error) {
+	var rev Revision
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(keyBucket)
+		if bucket == nil {
+			return fmt.Errorf("snapshot %s has no %q bucket", s.path, keyBucket)
+		}
+
+		k, _ := bucket.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		var err error
+		rev, _, err = parseRevisionKey(k)
+		return err
+	})
+	return rev.Main, err
+}
+
+// parseRevisionKey decodes a key bucket key into its revision and tombstone flag.
+func parseRevisionKey(k []byte) (Revision, bool, error) {
+	if len(k) != revisionKeyLen && !(len(k) == revisionKeyLen+1 && k[revisionKeyLen] == tombstoneMarker) {
+		return Revision{}, false, fmt.Errorf("malformed revision key %x", k)
+	}
+
+	rev := Revision{
+		Main: int64(binary.BigEndian.Uint64(k[0:8])),
+		Sub:  int64(binary.BigEndian.Uint64(k[9:17])),
+	}
+	return rev, len(k) == revisionKeyLen+1, nil
+}
@@ -0,0 +1,115 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/snapshot/snapshottest"
+)
+
+func TestKeys(t *testing.T) {
+	path := snapshottest.Write(t,
+		snapshottest.Put("/registry/pods/default/a", []byte("one")),
+		snapshottest.Put("/registry/pods/default/b", []byte("two")),
+		snapshottest.Put("/registry/pods/default/a", []byte("three!")),
+		snapshottest.Delete("/registry/pods/default/b"),
+		snapshottest.Put("/registry/configmaps/default/c", []byte("four")),
+	)
+
+	snap, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	kvs, err := snap.Keys("/registry/pods/")
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	if len(kvs) != 1 {
+		t.Fatalf("expected 1 live pod key, got %+v", kvs)
+	}
+
+	got := kvs[0]
+	want := KeyValue{Key: "/registry/pods/default/a", CreateRevision: 2, ModRevision: 4, Version: 2, Size: 6, Value: []byte("three!")}
+	if got.Key != want.Key || got.CreateRevision != want.CreateRevision || got.ModRevision != want.ModRevision ||
+		got.Version != want.Version || got.Size != want.Size || string(got.Value) != string(want.Value) {
+		t.Errorf("Keys()[0] = %+v, want %+v", got, want)
+	}
+
+	all, err := snap.Keys("")
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	if len(all) != 2 || all[0].Key != "/registry/configmaps/default/c" {
+		t.Errorf("unexpected keys: %+v", all)
+	}
+
+	rev, err := snap.Revision()
+	if err != nil {
+		t.Fatalf("Revision: %v", err)
+	}
+	if rev != 6 {
+		t.Errorf("Revision() = %d, want 6", rev)
+	}
+}
+
+func TestKeysWithPrefixes(t *testing.T) {
+	path := snapshottest.Write(t,
+		snapshottest.Put("/registry/minions/node-1", []byte("1")),
+		snapshottest.Put("/registry/pods/default/a", []byte("2")),
+		snapshottest.Put("/registry/configmaps/kube-system/kubeadm-config", []byte("3")),
+		snapshottest.Delete("/registry/minions/node-1"),
+		snapshottest.Put("/registry/minions/node-2", []byte("4")),
+	)
+
+	snap, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	kvs, err := snap.KeysWithPrefixes("/registry/minions/", "/registry/configmaps/kube-system/kubeadm-config")
+	if err != nil {
+		t.Fatalf("KeysWithPrefixes: %v", err)
+	}
+	var keys []string
+	for _, kv := range kvs {
+		keys = append(keys, kv.Key)
+	}
+	if len(keys) != 2 || keys[0] != "/registry/configmaps/kube-system/kubeadm-config" || keys[1] != "/registry/minions/node-2" {
+		t.Errorf("KeysWithPrefixes() = %q", keys)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	path := snapshottest.Write(t,
+		snapshottest.Put("/a", []byte("1")),
+		snapshottest.Delete("/a"),
+	)
+
+	snap, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	var revs []Revision
+	var tombstones []bool
+	err = snap.Walk(func(rev Revision, kv KeyValue) error {
+		revs = append(revs, rev)
+		tombstones = append(tombstones, kv.Tombstone)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if len(revs) != 2 || revs[0].Main != 2 || revs[1].Main != 3 || tombstones[0] || !tombstones[1] {
+		t.Errorf("unexpected walk: revs=%v tombstones=%v", revs, tombstones)
+	}
+}
+
+func TestOpenInvalidFile(t *testing.T) {
+	if _, err := Open(t.TempDir()); err == nil {
+		t.Fatal("expected error opening a directory")
+	}
+}
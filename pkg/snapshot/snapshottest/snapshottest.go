@@ -0,0 +1,151 @@
+// Package snapshottest builds small etcd snapshot files for tests.
+package snapshottest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+)
+
+// Op is a single change applied to a test snapshot.
+type Op struct {
+	Key    string
+	Value  []byte
+	Delete bool
+}
+
+// Put returns an operation storing value under key.
+func Put(key string, value []byte) Op {
+	return Op{Key: key, Value: value}
+}
+
+// Delete returns an operation deleting key.
+func Delete(key string) Op {
+	return Op{Key: key, Delete: true}
+}
+
+// Write creates a snapshot in a temporary directory with one revision per
+// operation, the way etcd would have recorded them, and returns its path.
+func Write(t testing.TB, ops ...Op) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatalf("failed to create test snapshot: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("key"))
+		if err != nil {
+			return err
+		}
+
+		created := map[string]int64{}
+		versions := map[string]int64{}
+		// etcd starts at revision 1, the first write is revision 2
+		for i, op := range ops {
+			rev := int64(i + 2)
+			kv := mvccpb.KeyValue{Key: []byte(op.Key)}
+			revKey := revisionKey(rev, op.Delete)
+
+			if op.Delete {
+				delete(created, op.Key)
+				delete(versions, op.Key)
+			} else {
+				if _, ok := created[op.Key]; !ok {
+					created[op.Key] = rev
+				}
+				versions[op.Key]++
+				kv.CreateRevision = created[op.Key]
+				kv.ModRevision = rev
+				kv.Version = versions[op.Key]
+				kv.Value = op.Value
+			}
+
+			data, err := kv.Marshal()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(revKey, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to write test snapshot: %v", err)
+	}
+
+	return path
+}
+
+// Compact records a completed compaction at revision in the meta bucket, the way etcd does.
+// Unlike etcd it keeps the older revisions.
+func Compact(t testing.TB, path string, revision int64) {
+	t.Helper()
+
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatalf("failed to open test snapshot: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("finishedCompactRev"), revisionKey(revision, false))
+	})
+	if err != nil {
+		t.Fatalf("failed to compact test snapshot: %v", err)
+	}
+}
+
+// AppendHash appends the sha256 digest "etcdctl snapshot save" writes after the database.
+func AppendHash(t testing.TB, path string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if err := os.WriteFile(path, append(data, sum[:]...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Protobuf encodes obj the way kube-apiserver stores it, including the "k8s\x00"
+// envelope. The object's TypeMeta must be set.
+func Protobuf(t testing.TB, obj runtime.Object) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := protobuf.NewSerializer(nil, nil).Encode(obj, &buf); err != nil {
+		t.Fatalf("failed to encode %T: %v", obj, err)
+	}
+	return buf.Bytes()
+}
+
+// revisionKey encodes a revision the way the etcd key bucket does.
+func revisionKey(main int64, tombstone bool) []byte {
+	key := make([]byte, 17, 18)
+	binary.BigEndian.PutUint64(key[0:8], uint64(main))
+	key[8] = '_'
+	binary.BigEndian.PutUint64(key[9:17], 0)
+	if tombstone {
+		key = append(key, 't')
+	}
+	return key
+}
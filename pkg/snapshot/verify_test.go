@@ -0,0 +1,108 @@
+package snapshot
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/supporttools/snapshot-insight/pkg/snapshot/snapshottest"
+)
+
+func TestVerify(t *testing.T) {
+	ops := []snapshottest.Op{
+		snapshottest.Put("/registry/pods/default/a", []byte("one")),
+		snapshottest.Put("/registry/pods/default/b", []byte("two")),
+		snapshottest.Delete("/registry/pods/default/b"),
+	}
+
+	tests := []struct {
+		name     string
+		prepare  func(t testing.TB, path string)
+		wantHash bool
+		wantErr  string
+	}{
+		{
+			name: "raw database without digest",
+		},
+		{
+			name:     "etcdctl snapshot with digest",
+			prepare:  snapshottest.AppendHash,
+			wantHash: true,
+		},
+		{
+			name: "truncated upload",
+			prepare: func(t testing.TB, path string) {
+				snapshottest.AppendHash(t, path)
+				truncate(t, path, 100)
+			},
+			wantErr: "likely truncated",
+		},
+		{
+			name: "corrupted digest",
+			prepare: func(t testing.TB, path string) {
+				snapshottest.AppendHash(t, path)
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data[len(data)-1] ^= 0xff
+				if err := os.WriteFile(path, data, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "failed sha256 verification",
+		},
+		{
+			name: "not a bbolt file",
+			prepare: func(t testing.TB, path string) {
+				if err := os.WriteFile(path, make([]byte, 4096), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "not a valid bbolt database",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := snapshottest.Write(t, ops...)
+			if tt.prepare != nil {
+				tt.prepare(t, path)
+			}
+
+			report, err := Verify(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+
+			if report.HasHash != tt.wantHash {
+				t.Errorf("HasHash = %v, want %v", report.HasHash, tt.wantHash)
+			}
+			if report.Revision != 4 || report.KeyCount != 1 || report.Revisions != 3 {
+				t.Errorf("unexpected report: %+v", report)
+			}
+			if report.DBSize%hashAlignment != 0 {
+				t.Errorf("DBSize %d is not page aligned", report.DBSize)
+			}
+		})
+	}
+}
+
+// truncate shortens the file at path by n bytes.
+func truncate(t testing.TB, path string, n int64) {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-n); err != nil {
+		t.Fatal(err)
+	}
+}